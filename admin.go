@@ -14,23 +14,28 @@ import (
 	"github.com/imchuncai/umem-cache-client-Go/proto"
 )
 
-func nap() {
-	time.Sleep(100 * time.Millisecond)
+// AdminConfig configures the admin helpers WithConfig, see Config.Admin.
+type AdminConfig struct {
+	Dialer proto.Dialer
+	Retry  RetryPolicy
 }
 
-func verifyLeader(deadline time.Time, addrs []string, config *tls.Config) error {
+func verifyLeader(deadline time.Time, addrs []string, config AdminConfig) error {
+	attempt := 1
 	for i := 0; i < len(addrs); i++ {
 		addr := addrs[i]
-		leader, err := AdminLeader(deadline, addr, config)
+		leader, err := AdminLeaderWithConfig(deadline, addr, config)
 		if err != nil {
-			if errIsIOTimeout(err) {
+			if !config.Retry.retry(attempt, err) {
 				return fmt.Errorf("request leader failed: %w", err)
 			}
 
+			config.Retry.sleepDeadline(deadline, attempt)
+			attempt++
 			i--
-			nap()
 			continue
 		}
+		attempt = 1
 		if leader != addrs[0] {
 			return errors.New("cluster is not stable")
 		}
@@ -38,7 +43,7 @@ func verifyLeader(deadline time.Time, addrs []string, config *tls.Config) error
 	return nil
 }
 
-func AdminInitCluster(deadline time.Time, addresses []string, config *tls.Config) error {
+func AdminInitClusterWithConfig(deadline time.Time, addresses []string, config AdminConfig) error {
 	addrs, err := proto.ResolveAddresses(addresses)
 	if err != nil {
 		return fmt.Errorf("resolve addresses failed: %w", err)
@@ -46,7 +51,7 @@ func AdminInitCluster(deadline time.Time, addresses []string, config *tls.Config
 
 	const wrapper = "init cluster failed: %w, you should restart all machines before retry"
 
-	conn, err := proto.Dial(deadline, addresses[0], config)
+	conn, err := proto.DialWithDialer(deadline, addresses[0], config.Dialer)
 	if err != nil {
 		return fmt.Errorf("dial initial leader failed: %w", err)
 	}
@@ -108,8 +113,8 @@ func growMachines(cluster proto.Cluster, to []*net.TCPAddr) ([]proto.Machine, er
 	return machines, nil
 }
 
-// Note: change may not really happen, you can check by AdminClusterMatch()
-func AdminChangeCluster(deadline time.Time, fromAddresses, toAddresses []string, config *tls.Config) error {
+// Note: change may not really happen, you can check by AdminClusterMatchWithConfig()
+func AdminChangeClusterWithConfig(deadline time.Time, fromAddresses, toAddresses []string, config AdminConfig) error {
 	_, err := proto.ResolveAddresses(fromAddresses)
 	if err != nil {
 		return fmt.Errorf("resolve from addresses failed: %w", err)
@@ -119,7 +124,7 @@ func AdminChangeCluster(deadline time.Time, fromAddresses, toAddresses []string,
 		return fmt.Errorf("resolve to addresses failed: %w", err)
 	}
 
-	leader, cluster, err := AdminLeaderCluster(deadline, fromAddresses, config)
+	leader, cluster, err := AdminLeaderClusterWithConfig(deadline, fromAddresses, config)
 	if err != nil {
 		return err
 	}
@@ -139,7 +144,7 @@ func AdminChangeCluster(deadline time.Time, fromAddresses, toAddresses []string,
 		return err
 	}
 
-	conn, err := proto.Dial(deadline, leader, config)
+	conn, err := proto.DialWithDialer(deadline, leader, config.Dialer)
 	if err != nil {
 		return fmt.Errorf("dial leader failed: %w", err)
 	}
@@ -157,14 +162,14 @@ func AdminChangeCluster(deadline time.Time, fromAddresses, toAddresses []string,
 	return nil
 }
 
-func AdminClusterMatch(deadline time.Time, addresses []string, config *tls.Config) error {
+func AdminClusterMatchWithConfig(deadline time.Time, addresses []string, config AdminConfig) error {
 	addrs, err := proto.ResolveAddresses(addresses)
 	if err != nil {
 		return fmt.Errorf("resolve addresses failed: %w", err)
 	}
 
 	for {
-		_, cluster, err := AdminLeaderCluster(deadline, addresses, config)
+		_, cluster, err := AdminLeaderClusterWithConfig(deadline, addresses, config)
 		if err != nil {
 			return err
 		}
@@ -175,7 +180,7 @@ func AdminClusterMatch(deadline time.Time, addresses []string, config *tls.Confi
 	}
 }
 
-func leaderRandom(deadline time.Time, addrs []string, config *tls.Config) (string, error) {
+func leaderRandom(deadline time.Time, addrs []string, config AdminConfig) (string, error) {
 	cp := make([]string, len(addrs))
 	copy(cp, addrs)
 
@@ -184,16 +189,16 @@ func leaderRandom(deadline time.Time, addrs []string, config *tls.Config) (strin
 	})
 
 	for _, addr := range cp {
-		leader, err := AdminLeader(deadline, addr, config)
-		if err == nil || errIsIOTimeout(err) {
+		leader, err := AdminLeaderWithConfig(deadline, addr, config)
+		if err == nil || !config.Retry.retryable(err) {
 			return leader, err
 		}
 	}
 	return "", errors.New("lost leader")
 }
 
-func cluster(deadline time.Time, address string, config *tls.Config) (proto.Cluster, error) {
-	conn, err := proto.Dial(deadline, address, config)
+func cluster(deadline time.Time, address string, config AdminConfig) (proto.Cluster, error) {
+	conn, err := proto.DialWithDialer(deadline, address, config.Dialer)
 	if err != nil {
 		return proto.Cluster{}, fmt.Errorf("dial:%s failed: %w", address, err)
 	}
@@ -211,7 +216,7 @@ func cluster(deadline time.Time, address string, config *tls.Config) (proto.Clus
 	return cluster, nil
 }
 
-func AdminLeaderCluster(deadline time.Time, addresses []string, config *tls.Config) (string, proto.Cluster, error) {
+func AdminLeaderClusterWithConfig(deadline time.Time, addresses []string, config AdminConfig) (string, proto.Cluster, error) {
 	do := func() (string, proto.Cluster, error) {
 		leader, err := leaderRandom(deadline, addresses, config)
 		if err != nil {
@@ -226,17 +231,17 @@ func AdminLeaderCluster(deadline time.Time, addresses []string, config *tls.Conf
 		return leader, cluster, nil
 	}
 
-	for {
+	for attempt := 1; ; attempt++ {
 		leader, cluster, err := do()
-		if err == nil || errIsIOTimeout(err) {
+		if err == nil || !config.Retry.retry(attempt, err) {
 			return leader, cluster, err
 		}
-		nap()
+		config.Retry.sleepDeadline(deadline, attempt)
 	}
 }
 
-func AdminLeader(deadline time.Time, address string, config *tls.Config) (string, error) {
-	conn, err := proto.Dial(deadline, address, config)
+func AdminLeaderWithConfig(deadline time.Time, address string, config AdminConfig) (string, error) {
+	conn, err := proto.DialWithDialer(deadline, address, config.Dialer)
 	if err != nil {
 		return "", fmt.Errorf("dial failed: %w", err)
 	}
@@ -249,11 +254,43 @@ func AdminLeader(deadline time.Time, address string, config *tls.Config) (string
 	return conn.Leader()
 }
 
-func AdminCluster(deadline time.Time, address string, config *tls.Config) (proto.Cluster, error) {
-	_, err := net.ResolveTCPAddr("tcp6", address)
+func AdminClusterWithConfig(deadline time.Time, address string, config AdminConfig) (proto.Cluster, error) {
+	_, err := net.ResolveTCPAddr("tcp", address)
 	if err != nil {
 		return proto.Cluster{}, fmt.Errorf("resolve addresses failed: %w", err)
 	}
 
 	return cluster(deadline, address, config)
 }
+
+// tlsAdmin is the AdminConfig of the admin helpers taking a *tls.Config, they
+// retry every 100ms until the deadline.
+func tlsAdmin(config *tls.Config) AdminConfig {
+	return AdminConfig{Dialer: proto.Dialer{TLSConfig: config}}
+}
+
+// AdminInitCluster is AdminInitClusterWithConfig, with TLS if config is not
+// nil.
+func AdminInitCluster(deadline time.Time, addresses []string, config *tls.Config) error {
+	return AdminInitClusterWithConfig(deadline, addresses, tlsAdmin(config))
+}
+
+func AdminChangeCluster(deadline time.Time, fromAddresses, toAddresses []string, config *tls.Config) error {
+	return AdminChangeClusterWithConfig(deadline, fromAddresses, toAddresses, tlsAdmin(config))
+}
+
+func AdminClusterMatch(deadline time.Time, addresses []string, config *tls.Config) error {
+	return AdminClusterMatchWithConfig(deadline, addresses, tlsAdmin(config))
+}
+
+func AdminLeaderCluster(deadline time.Time, addresses []string, config *tls.Config) (string, proto.Cluster, error) {
+	return AdminLeaderClusterWithConfig(deadline, addresses, tlsAdmin(config))
+}
+
+func AdminLeader(deadline time.Time, address string, config *tls.Config) (string, error) {
+	return AdminLeaderWithConfig(deadline, address, tlsAdmin(config))
+}
+
+func AdminCluster(deadline time.Time, address string, config *tls.Config) (proto.Cluster, error) {
+	return AdminClusterWithConfig(deadline, address, tlsAdmin(config))
+}
@@ -6,6 +6,7 @@ package client
 import (
 	"container/list"
 	"errors"
+	"log/slog"
 	"sync"
 	"time"
 
@@ -13,7 +14,9 @@ import (
 )
 
 type authority struct {
-	conn *proto.AuthorityConn
+	conn   *proto.AuthorityConn
+	leader string
+	logger *slog.Logger
 
 	mu       sync.Mutex
 	requests *list.List
@@ -21,16 +24,18 @@ type authority struct {
 	busy     bool
 }
 
-func newAuthority(conn *proto.AuthorityConn) *authority {
+func newAuthority(conn *proto.AuthorityConn, leader string, logger *slog.Logger) *authority {
 	auth := &authority{
 		conn:     conn,
+		leader:   leader,
+		logger:   logger,
 		requests: list.New(),
 	}
 	go func() {
 		for {
 			approval, err := conn.RecvApproval()
 			if err != nil {
-				auth.Close()
+				auth.lost(err)
 				return
 			}
 
@@ -71,6 +76,15 @@ func (auth *authority) Close() {
 	auth.requests = nil
 }
 
+// lost closes the authority for the connection is broken.
+func (auth *authority) lost(err error) {
+	// no log for the authority closed by us
+	if !auth.Closed() {
+		auth.logger.Warn("authority connection lost", logLeader, auth.leader, "error", err)
+	}
+	auth.Close()
+}
+
 func (auth *authority) pushAuthority() (<-chan uint64, int, error) {
 	auth.mu.Lock()
 	defer auth.mu.Unlock()
@@ -101,7 +115,7 @@ func (auth *authority) RequestPermission(deadline time.Time) (<-chan uint64, err
 
 	err = auth.conn.RequestPermission(deadline, n)
 	if err != nil {
-		auth.Close()
+		auth.lost(err)
 		return nil, err
 	}
 
@@ -137,7 +151,7 @@ func (auth *authority) receivedApproval(approval proto.Approval) {
 	if n > 0 {
 		err := auth.conn.RequestPermission(time.Time{}, n)
 		if err != nil {
-			auth.Close()
+			auth.lost(err)
 		}
 	}
 }
@@ -0,0 +1,358 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+// BatchFallbackGetFunc returns values in the order of keys.
+type BatchFallbackGetFunc func(keys [][]byte) (vals [][]byte, err error)
+
+type BatchFallbackGetContextFunc func(ctx context.Context, keys [][]byte) (vals [][]byte, err error)
+
+type Result struct {
+	Val []byte
+	Err error
+	// Uncached is set if Val is got from the fallback directly, in degraded
+	// mode or by Breaker.FailOpen, Err is nil then.
+	Uncached bool
+}
+
+type batchKey struct {
+	key   []byte // key sent to the server
+	index int
+}
+
+type batchMiss struct {
+	conn  *proto.CacheConn
+	index int
+}
+
+// batchGroup is the keys of a thread.
+type batchGroup struct {
+	thread *thread
+	keys   []batchKey
+	misses []batchMiss // keys missed, whose connections hold the tickets
+	rest   []batchKey  // keys not looked up for want of tickets
+
+	fetched chan struct{} // closed when vals or err is set
+	vals    map[int][]byte
+	err     error
+}
+
+// minBatchWait is the least time the fallback call waits for threads late.
+const minBatchWait = 100 * time.Millisecond
+
+// batch looks up keys concurrently by thread, and calls the fallback once
+// with all keys missed. The first ticket of each thread is taken in the order
+// of threads, and no ticket is waited for while holding missed keys, so
+// batches never wait on each other for tickets. The keys left for want of
+// tickets are fetched by the fallback too, and are looked up after the missed
+// keys are populated.
+type batch struct {
+	keys    [][]byte
+	results []Result
+	unique  []int
+	first   []int // index of the first same key
+}
+
+func newBatch(keys [][]byte) *batch {
+	b := &batch{
+		keys:    keys,
+		results: make([]Result, len(keys)),
+		first:   make([]int, len(keys)),
+	}
+
+	seen := make(map[string]int, len(keys))
+	for i, key := range keys {
+		j, ok := seen[string(key)]
+		if !ok {
+			j = i
+			seen[string(key)] = i
+			b.unique = append(b.unique, i)
+		}
+		b.first[i] = j
+	}
+	return b
+}
+
+func (b *batch) run(ctx context.Context, deadline time.Time, groups map[*thread][]batchKey, get BatchFallbackGetFunc) {
+	start := time.Now()
+	gs := make([]batchGroup, 0, len(groups))
+	for t, keys := range groups {
+		// keep the locking order of keys in the same thread
+		slices.SortFunc(keys, func(a, b batchKey) int {
+			return bytes.Compare(a.key, b.key)
+		})
+		gs = append(gs, batchGroup{thread: t, keys: keys})
+	}
+	slices.SortFunc(gs, func(a, b batchGroup) int {
+		return cmp.Or(strings.Compare(a.thread.route, b.thread.route), cmp.Compare(a.thread.id, b.thread.id))
+	})
+
+	// the keys of a thread fail if its first ticket is not acquired
+	var err error
+	for i := range gs {
+		g := &gs[i]
+		if err == nil {
+			err = g.thread.acquireTicket(ctx, deadline)
+		}
+		if err != nil {
+			for _, k := range g.keys {
+				b.results[k.index] = Result{Err: err}
+			}
+			g.keys = nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	looked := make(chan *batchGroup, len(gs))
+	n := 0
+	for i := range gs {
+		g := &gs[i]
+		if len(g.keys) == 0 {
+			continue
+		}
+
+		n++
+		g.fetched = make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			g.misses, g.rest = b.lookup(ctx, deadline, g.thread, g.keys)
+			looked <- g
+			<-g.fetched
+			for _, m := range g.misses {
+				b.populate(ctx, g.thread, m, g.vals, g.err)
+				g.thread.releaseTicket()
+			}
+			b.lookupRest(ctx, deadline, g.thread, g.rest, g.vals, g.err)
+		}()
+	}
+	b.fetch(start, looked, n, get)
+	wg.Wait()
+}
+
+// fetch calls get once with the keys of all n groups looked up. The groups
+// late are not waited for longer than the first group took, as they may wait
+// for keys held by another batch that waits for the keys held by this batch,
+// get is called again for them.
+func (b *batch) fetch(start time.Time, looked <-chan *batchGroup, n int, get BatchFallbackGetFunc) {
+	var ready []*batchGroup
+	timer := time.NewTimer(0)
+	timer.Stop()
+	defer timer.Stop()
+
+	for n > 0 {
+		select {
+		case g := <-looked:
+			n--
+			ready = append(ready, g)
+			if n > 0 {
+				if len(ready) == 1 {
+					timer.Reset(max(time.Since(start), minBatchWait))
+				}
+				continue
+			}
+		case <-timer.C:
+		}
+
+		timer.Stop()
+		b.fetchGroups(ready, get)
+		ready = nil
+	}
+}
+
+func (b *batch) fetchGroups(groups []*batchGroup, get BatchFallbackGetFunc) {
+	var indexes []int
+	for _, g := range groups {
+		for _, m := range g.misses {
+			indexes = append(indexes, m.index)
+		}
+		for _, k := range g.rest {
+			indexes = append(indexes, k.index)
+		}
+	}
+
+	var vals [][]byte
+	var err error
+	if len(indexes) > 0 {
+		keys := make([][]byte, len(indexes))
+		for n, i := range indexes {
+			keys[n] = b.keys[i]
+		}
+		vals, err = batchFallbackGet(keys, get)
+	}
+
+	fetched := make(map[int][]byte, len(indexes))
+	if err == nil {
+		for n, i := range indexes {
+			fetched[i] = vals[n]
+		}
+	}
+	for _, g := range groups {
+		g.vals, g.err = fetched, err
+		close(g.fetched)
+	}
+}
+
+// lookup is called with a ticket held, which is kept by a missed key, the
+// keys left once the tickets run out are returned as rest.
+func (b *batch) lookup(ctx context.Context, deadline time.Time, t *thread, keys []batchKey) (misses []batchMiss, rest []batchKey) {
+	ticket := true
+	for i, k := range keys {
+		if !ticket {
+			if !t.tryAcquireTicket() {
+				return misses, keys[i:]
+			}
+			t.observeTicketWait(0, nil)
+		}
+
+		val, conn, err := t.lookup(ctx, deadline, nil, k.key)
+		if conn == nil {
+			b.results[k.index] = Result{Val: val, Err: err}
+			ticket = true
+			continue
+		}
+		misses = append(misses, batchMiss{conn, k.index})
+		ticket = false
+	}
+	if ticket {
+		t.releaseTicket()
+	}
+	return misses, nil
+}
+
+// lookupRest looks up keys left by lookup, a miss is populated by the value
+// fetched.
+func (b *batch) lookupRest(ctx context.Context, deadline time.Time, t *thread, keys []batchKey, fetched map[int][]byte, ferr error) {
+	for _, k := range keys {
+		err := t.acquireTicket(ctx, deadline)
+		if err != nil {
+			b.results[k.index] = Result{Err: err}
+			continue
+		}
+
+		val, conn, err := t.lookup(ctx, deadline, nil, k.key)
+		if conn == nil {
+			b.results[k.index] = Result{Val: val, Err: err}
+		} else {
+			b.populate(ctx, t, batchMiss{conn, k.index}, fetched, ferr)
+		}
+		t.releaseTicket()
+	}
+}
+
+// populate sets the value fetched for m, or drops m if the fallback failed
+// with err.
+func (b *batch) populate(ctx context.Context, t *thread, m batchMiss, fetched map[int][]byte, err error) {
+	if err != nil {
+		t.closeConn(m.conn, err)
+		b.results[m.index] = Result{Err: err}
+		return
+	}
+
+	val := fetched[m.index]
+	t.populate(ctx, m.conn, val)
+	b.results[m.index] = Result{Val: val}
+}
+
+func batchFallbackGet(keys [][]byte, get BatchFallbackGetFunc) ([][]byte, error) {
+	if get == nil {
+		return nil, fmt.Errorf("%w: nil", proto.ErrFallbackGet)
+	}
+
+	vals, err := get(keys)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", proto.ErrFallbackGet, err)
+	}
+
+	if len(vals) != len(keys) {
+		return nil, fmt.Errorf("%w: got %d values for %d keys", proto.ErrFallbackGet, len(vals), len(keys))
+	}
+	return vals, nil
+}
+
+func batchFallbackWithContext(ctx context.Context, get BatchFallbackGetContextFunc) BatchFallbackGetFunc {
+	if get == nil {
+		return nil
+	}
+
+	return func(keys [][]byte) ([][]byte, error) {
+		return get(ctx, keys)
+	}
+}
+
+// retryErr returns the first error of indexes that worth retrying.
+func (b *batch) retryErr(indexes []int, retryable func(err error) bool) error {
+	for _, i := range indexes {
+		if err := b.results[i].Err; err != nil && retryable(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// failed returns indexes of keys failed.
+func (b *batch) failed(indexes []int) []int {
+	var failed []int
+	for _, i := range indexes {
+		if b.results[i].Err != nil {
+			failed = append(failed, i)
+		}
+	}
+	return failed
+}
+
+// fail sets err to keys that have not failed.
+func (b *batch) fail(err error) {
+	for _, i := range b.unique {
+		if b.results[i].Err == nil {
+			b.results[i] = Result{Err: err}
+		}
+	}
+}
+
+// fallback populates keys failed with errors matched by a single call of
+// get, the values are not cached, and are marked uncached.
+func (b *batch) fallback(match func(err error) bool, get BatchFallbackGetFunc) {
+	var indexes []int
+	var keys [][]byte
+	for _, i := range b.unique {
+		if match(b.results[i].Err) {
+			indexes = append(indexes, i)
+			keys = append(keys, b.keys[i])
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	vals, err := batchFallbackGet(keys, get)
+	for n, i := range indexes {
+		if err != nil {
+			b.results[i] = Result{Err: err}
+		} else {
+			b.results[i] = Result{Val: vals[n], Uncached: true}
+		}
+	}
+}
+
+func (b *batch) done() []Result {
+	for i, j := range b.first {
+		b.results[i] = b.results[j]
+	}
+	return b.results
+}
@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+// ErrCircuitOpen is returned without talking to a Cluster member whose
+// circuit is open, it is not retried.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// errTimeout is the cause of a ctx done by Config.Timeout, unlike the ctx of
+// the caller, it says the member is slow.
+var errTimeout = errors.New("cluster operation timed out")
+
+type BreakerConfig struct {
+	// Failures is the number of consecutive failures of a member that opens
+	// its circuit, 0 for no circuit breaker.
+	Failures int
+	// OpenTimeout is how long an open circuit rejects calls before it lets
+	// a trial call through.
+	OpenTimeout time.Duration
+	// FailOpen calls the fallback directly instead of returning
+	// ErrCircuitOpen, the values are not cached, see Result.Uncached.
+	FailOpen bool
+}
+
+type BreakerState byte
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+var breakerStates = [...]string{
+	BreakerClosed:   "closed",
+	BreakerOpen:     "open",
+	BreakerHalfOpen: "half-open",
+}
+
+func (s BreakerState) String() string {
+	if int(s) >= len(breakerStates) {
+		return "invalid-breaker-state"
+	}
+	return breakerStates[s]
+}
+
+type BreakerStats struct {
+	State BreakerState
+	// Opens counts how many times the circuit opened.
+	Opens uint64
+}
+
+// breaker is a circuit breaker of a member, nil for no circuit breaker.
+// It is rebuilt with the member when the cluster version changes.
+type breaker struct {
+	failures    int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	fails    int
+	openedAt time.Time
+	trial    bool // a trial call of the half-open circuit is in flight
+	opens    uint64
+}
+
+func newBreaker(conf BreakerConfig) *breaker {
+	if conf.Failures == 0 {
+		return nil
+	}
+	return &breaker{failures: conf.Failures, openTimeout: conf.OpenTimeout}
+}
+
+// allow reports whether a call can go through, and whether it is the trial
+// call of the half-open circuit. A call allowed should be reported by done.
+func (b *breaker) allow() (ok, trial bool) {
+	if b == nil {
+		return true, false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false, false
+		}
+		b.state = BreakerHalfOpen
+	case BreakerHalfOpen:
+		if b.trial {
+			return false, false
+		}
+	default:
+		return true, false
+	}
+	b.trial = true
+	return true, true
+}
+
+// callerDone reports whether ctx is done by the caller, not by Config.Timeout.
+func callerDone(ctx context.Context) bool {
+	if ctx.Err() == nil {
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Now().Before(deadline) {
+			return false
+		}
+		// a context derived with the same deadline may expire first
+		<-ctx.Done()
+	}
+	return context.Cause(ctx) != errTimeout
+}
+
+// breakerFailure reports whether err of a call with ctx says the member is
+// unhealthy.
+func breakerFailure(ctx context.Context, err error) bool {
+	return err != nil && !callerDone(ctx) &&
+		!errors.Is(err, proto.ErrClientSide) && !errors.Is(err, ErrCircuitOpen)
+}
+
+// done reports a call allowed with ctx, trial is got from allow. A call
+// allowed before the circuit opened is stale, it is ignored until the circuit
+// is closed.
+func (b *breaker) done(ctx context.Context, err error, trial bool) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !trial && b.state != BreakerClosed {
+		return
+	}
+
+	b.trial = false
+	switch {
+	case breakerFailure(ctx, err):
+		b.fails++
+		if trial || b.fails >= b.failures {
+			b.opens++
+			b.state = BreakerOpen
+			b.openedAt = time.Now()
+		}
+	case err == nil || (trial && !callerDone(ctx)):
+		// a trial call that reaches the member closes the circuit
+		b.state = BreakerClosed
+		b.fails = 0
+	}
+}
+
+func (b *breaker) stats() BreakerStats {
+	if b == nil {
+		return BreakerStats{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return BreakerStats{State: b.state, Opens: b.opens}
+}
+
+// call calls f with ctx if the circuit allows.
+func (b *breaker) call(ctx context.Context, address string, f func() error) error {
+	ok, trial := b.allow()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrCircuitOpen, address)
+	}
+
+	err := f()
+	b.done(ctx, err, trial)
+	return err
+}
+
+func directFallbackGet(key []byte, get proto.FallbackGetFunc) ([]byte, error) {
+	if get == nil {
+		return nil, fmt.Errorf("%w: nil", proto.ErrFallbackGet)
+	}
+
+	val, err := get(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", proto.ErrFallbackGet, err)
+	}
+	return val, nil
+}
+
+func directStreamFallbackGet(ctx context.Context, key []byte, get StreamFallbackGetFunc) (io.ReadCloser, int64, error) {
+	if get == nil {
+		return nil, 0, fmt.Errorf("%w: nil", proto.ErrFallbackGet)
+	}
+
+	r, size, err := get(ctx, key)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", proto.ErrFallbackGet, err)
+	}
+	if rc, ok := r.(io.ReadCloser); ok {
+		return rc, size, nil
+	}
+	return io.NopCloser(r), size, nil
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+func TestBreaker(t *testing.T) {
+	const openTimeout = 50 * time.Millisecond
+
+	failure := errors.New("failure")
+	b := newBreaker(BreakerConfig{Failures: 2, OpenTimeout: openTimeout})
+	want := func(state BreakerState, opens uint64) {
+		t.Helper()
+		if stats := b.stats(); stats.State != state || stats.Opens != opens {
+			t.Fatalf("want state: %v opens: %d, got: %+v", state, opens, stats)
+		}
+	}
+
+	ctx := context.Background()
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	expired, cancel := context.WithDeadline(ctx, time.Now())
+	defer cancel()
+	timeout, cancel := context.WithDeadlineCause(ctx, time.Now(), errTimeout)
+	defer cancel()
+
+	// client side errors, failures of the caller's ctx and a success in
+	// between do not count
+	for _, call := range []struct {
+		ctx context.Context
+		err error
+	}{
+		{ctx, failure},
+		{ctx, proto.ErrFallbackGet},
+		{canceled, canceled.Err()},
+		{expired, expired.Err()},
+		{ctx, nil},
+		{ctx, failure},
+	} {
+		ok, trial := b.allow()
+		if !ok || trial {
+			t.Fatal("closed circuit rejects")
+		}
+		b.done(call.ctx, call.err, trial)
+	}
+	want(BreakerClosed, 0)
+
+	// a call allowed before the circuit opens
+	_, staleTrial := b.allow()
+
+	_, trial := b.allow()
+	b.done(ctx, failure, trial)
+	want(BreakerOpen, 1)
+	if ok, _ := b.allow(); ok {
+		t.Fatal("open circuit allows")
+	}
+
+	time.Sleep(openTimeout)
+	ok, trial := b.allow()
+	if !ok || !trial {
+		t.Fatal("want a trial call")
+	}
+	want(BreakerHalfOpen, 1)
+	if ok, _ := b.allow(); ok {
+		t.Fatal("want only one trial call")
+	}
+
+	// the stale call neither closes the circuit nor ends the trial
+	b.done(ctx, nil, staleTrial)
+	want(BreakerHalfOpen, 1)
+	if ok, _ := b.allow(); ok {
+		t.Fatal("want only one trial call")
+	}
+
+	b.done(ctx, failure, trial)
+	want(BreakerOpen, 2)
+
+	// a trial call canceled by the caller does not close the circuit
+	time.Sleep(openTimeout)
+	_, trial = b.allow()
+	b.done(canceled, canceled.Err(), trial)
+	want(BreakerHalfOpen, 2)
+
+	_, trial = b.allow()
+	b.done(ctx, proto.ErrFallbackGet, trial)
+	want(BreakerClosed, 2)
+
+	// the timeout of the operation counts
+	for range 2 {
+		_, trial = b.allow()
+		b.done(timeout, timeout.Err(), trial)
+	}
+	want(BreakerOpen, 3)
+
+	var none *breaker
+	if ok, trial := none.allow(); !ok || trial || none.stats() != (BreakerStats{}) {
+		t.Fatal("nil breaker should allow all calls")
+	}
+	none.done(ctx, failure, false)
+}
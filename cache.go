@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"math"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+const (
+	KeySizeLimit        = math.MaxUint8
+	ClusterKeySizeLimit = KeySizeLimit - 8
+)
+
+// Cache is satisfied by *Client, *Cluster, *Memory and the wrappers of Cache.
+type Cache interface {
+	GetOrSet(key []byte, get proto.FallbackGetFunc) ([]byte, error)
+	GetOrSetContext(ctx context.Context, key []byte, get proto.FallbackGetContextFunc) ([]byte, error)
+	MultiGetOrSet(keys [][]byte, get BatchFallbackGetFunc) []Result
+	MultiGetOrSetContext(ctx context.Context, keys [][]byte, get BatchFallbackGetContextFunc) []Result
+	Del(key []byte) error
+	DelContext(ctx context.Context, key []byte) error
+	Close()
+}
+
+var (
+	_ Cache = (*Client)(nil)
+	_ Cache = (*Cluster)(nil)
+	_ Cache = (*Memory)(nil)
+	_ Cache = (*Compressed)(nil)
+	_ Cache = (*Encrypted)(nil)
+	_ Cache = (*LongKeys)(nil)
+	_ Cache = (*Chunked)(nil)
+)
@@ -0,0 +1,409 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+// The entry of a key starts with chunkMagic and a chunk kind. A small value
+// is stored inline, a big value is stored in chunks and the entry is a
+// manifest: id (8 bytes), value size (uvarint), chunk count (uvarint), and
+// the SHA-256 of the value. A chunk is stored under chunkMagic, id and index
+// (4 bytes little endian), and its value is prefixed by the same id and
+// index.
+const (
+	chunkMagic     = "\xffUC"
+	chunkIDSize    = 8
+	chunkIndexSize = 4
+	chunkKeySize   = len(chunkMagic) + chunkIDSize + chunkIndexSize
+)
+
+const (
+	chunkKindInline byte = iota
+	chunkKindManifest
+)
+
+// errChunkMismatch is returned for a missing, stale or corrupt chunk, the
+// manifest is deleted and the key is got again.
+var errChunkMismatch = errors.New("chunk mismatch")
+
+type ChunkConfig struct {
+	// ChunkSize is the most size of a chunk, keep it under the value limit
+	// of the server.
+	ChunkSize int
+}
+
+// Chunked is a Cache that stores a big value in chunks, they are got in one
+// MultiGetOrSet so in parallel across threads and members. Del removes the
+// manifest only, chunks left are never read and are evicted by the server.
+// Chunks are written after the manifest is set, a GetOrSet in between finds
+// a chunk missing and gets the value again.
+// Wrap Chunked by Compressed and Encrypted, so that values are compressed
+// and encrypted before they are chunked.
+type Chunked struct {
+	cache  Cache
+	config ChunkConfig
+}
+
+func NewChunked(cache Cache, config ChunkConfig) (*Chunked, error) {
+	if config.ChunkSize <= 0 {
+		return nil, fmt.Errorf("bad ChunkSize: %d", config.ChunkSize)
+	}
+	return &Chunked{cache, config}, nil
+}
+
+type chunkManifest struct {
+	id    [chunkIDSize]byte
+	size  uint64
+	count uint64
+	sum   [sha256.Size]byte
+}
+
+func (m *chunkManifest) key(i int) []byte {
+	key := make([]byte, 0, chunkKeySize)
+	key = append(key, chunkMagic...)
+	key = append(key, m.id[:]...)
+	return binary.LittleEndian.AppendUint32(key, uint32(i))
+}
+
+func (m *chunkManifest) keys() [][]byte {
+	keys := make([][]byte, m.count)
+	for i := range keys {
+		keys[i] = m.key(i)
+	}
+	return keys
+}
+
+func (m *chunkManifest) encode() []byte {
+	data := make([]byte, 0, len(chunkMagic)+1+chunkIDSize+2*binary.MaxVarintLen64+sha256.Size)
+	data = append(data, chunkMagic...)
+	data = append(data, chunkKindManifest)
+	data = append(data, m.id[:]...)
+	data = binary.AppendUvarint(data, m.size)
+	data = binary.AppendUvarint(data, m.count)
+	return append(data, m.sum[:]...)
+}
+
+// parseChunkEntry returns the inline value, or the manifest for nil value.
+func parseChunkEntry(data []byte) ([]byte, *chunkManifest, error) {
+	n := len(chunkMagic) + 1
+	if len(data) < n || !bytes.HasPrefix(data, []byte(chunkMagic)) {
+		// written without chunking
+		return data, nil, nil
+	}
+
+	switch data[n-1] {
+	case chunkKindInline:
+		return data[n:], nil, nil
+	case chunkKindManifest:
+	default:
+		return nil, nil, fmt.Errorf("unknown chunk kind: %d", data[n-1])
+	}
+
+	var m chunkManifest
+	data = data[n:]
+	if len(data) < chunkIDSize {
+		return nil, nil, errors.New("bad chunk manifest")
+	}
+	copy(m.id[:], data)
+	data = data[chunkIDSize:]
+
+	var k1, k2 int
+	m.size, k1 = binary.Uvarint(data)
+	if k1 > 0 {
+		m.count, k2 = binary.Uvarint(data[k1:])
+	}
+	if k1 <= 0 || k2 <= 0 || len(data[k1+k2:]) != sha256.Size || m.count > m.size || m.count > math.MaxUint32 {
+		return nil, nil, errors.New("bad chunk manifest")
+	}
+	copy(m.sum[:], data[k1+k2:])
+	return nil, &m, nil
+}
+
+func (c *Chunked) inline(val []byte) []byte {
+	data := make([]byte, 0, len(chunkMagic)+1+len(val))
+	data = append(data, chunkMagic...)
+	data = append(data, chunkKindInline)
+	return append(data, val...)
+}
+
+// chunkWrite is the chunks of a manifest.
+type chunkWrite struct {
+	keys   [][]byte
+	chunks [][]byte
+}
+
+// split returns the entry of the key, and the chunks to write for a big val.
+func (c *Chunked) split(val []byte) ([]byte, *chunkWrite, error) {
+	if len(val) <= c.config.ChunkSize {
+		return c.inline(val), nil, nil
+	}
+
+	m := chunkManifest{
+		size:  uint64(len(val)),
+		count: uint64((len(val) + c.config.ChunkSize - 1) / c.config.ChunkSize),
+		sum:   sha256.Sum256(val),
+	}
+	if m.count > math.MaxUint32 {
+		return nil, nil, fmt.Errorf("too many chunks: %d", m.count)
+	}
+	_, err := rand.Read(m.id[:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate chunk id failed: %w", err)
+	}
+
+	w := &chunkWrite{keys: m.keys(), chunks: make([][]byte, m.count)}
+	for i, key := range w.keys {
+		chunk := val[i*c.config.ChunkSize : min((i+1)*c.config.ChunkSize, len(val))]
+		data := make([]byte, 0, chunkIDSize+chunkIndexSize+len(chunk))
+		data = append(data, key[len(chunkMagic):]...)
+		w.chunks[i] = append(data, chunk...)
+	}
+	return m.encode(), w, nil
+}
+
+// write populates the chunks of keys in one MultiGetOrSet, after the entries
+// of keys are populated, so that chunks never wait on a ticket held for a key.
+// The entry of a key is deleted if its chunks fail, ws can have nil items.
+func (c *Chunked) write(ctx context.Context, keys [][]byte, ws []*chunkWrite) []error {
+	var chunkKeys [][]byte
+	chunks := make(map[string][]byte)
+	for _, w := range ws {
+		if w == nil {
+			continue
+		}
+		chunkKeys = append(chunkKeys, w.keys...)
+		for i, key := range w.keys {
+			chunks[string(key)] = w.chunks[i]
+		}
+	}
+	errs := make([]error, len(ws))
+	if len(chunkKeys) == 0 {
+		return errs
+	}
+
+	results := c.cache.MultiGetOrSetContext(ctx, chunkKeys, func(ctx context.Context, keys [][]byte) ([][]byte, error) {
+		vals := make([][]byte, len(keys))
+		for i, key := range keys {
+			vals[i] = chunks[string(key)]
+		}
+		return vals, nil
+	})
+
+	for i, w := range ws {
+		if w == nil {
+			continue
+		}
+		for j := range w.keys {
+			if err := results[0].Err; err != nil && errs[i] == nil {
+				errs[i] = fmt.Errorf("write chunk: %d failed: %w", j, err)
+			}
+			results = results[1:]
+		}
+		if errs[i] == nil {
+			continue
+		}
+
+		err := c.cache.DelContext(ctx, keys[i])
+		if err != nil {
+			errs[i] = fmt.Errorf("%w, del failed: %w", errs[i], err)
+		}
+	}
+	return errs
+}
+
+// read returns the value of the entry of the key.
+func (c *Chunked) read(ctx context.Context, data []byte) ([]byte, error) {
+	val, m, err := parseChunkEntry(data)
+	if err != nil || m == nil {
+		return val, err
+	}
+
+	keys := m.keys()
+	results := c.cache.MultiGetOrSetContext(ctx, keys, func(ctx context.Context, keys [][]byte) ([][]byte, error) {
+		return nil, errChunkMismatch
+	})
+
+	val = make([]byte, 0, m.size)
+	for i := range results {
+		if errors.Is(results[i].Err, errChunkMismatch) {
+			return nil, fmt.Errorf("%w: chunk: %d missing", errChunkMismatch, i)
+		}
+		if results[i].Err != nil {
+			return nil, fmt.Errorf("read chunk: %d failed: %w", i, results[i].Err)
+		}
+
+		chunk := results[i].Val
+		header := keys[i][len(chunkMagic):]
+		if !bytes.HasPrefix(chunk, header) {
+			return nil, fmt.Errorf("%w: chunk: %d stale", errChunkMismatch, i)
+		}
+		val = append(val, chunk[len(header):]...)
+	}
+
+	if uint64(len(val)) != m.size || sha256.Sum256(val) != m.sum {
+		return nil, fmt.Errorf("%w: checksum failed", errChunkMismatch)
+	}
+	return val, nil
+}
+
+func (c *Chunked) GetOrSet(key []byte, get proto.FallbackGetFunc) ([]byte, error) {
+	var _get proto.FallbackGetContextFunc
+	if get != nil {
+		_get = func(_ context.Context, key []byte) ([]byte, error) {
+			return get(key)
+		}
+	}
+	return c.GetOrSetContext(context.Background(), key, _get)
+}
+
+func (c *Chunked) GetOrSetContext(ctx context.Context, key []byte, get proto.FallbackGetContextFunc) ([]byte, error) {
+	for repair := true; ; repair = false {
+		var fc fallbackCapture[[]byte]
+		var w *chunkWrite
+		data, err := c.cache.GetOrSetContext(ctx, key, captureFallback(&fc, key, get, func(_ context.Context, val []byte) (data []byte, err error) {
+			data, w, err = c.split(val)
+			return data, err
+		}))
+		if err != nil {
+			return nil, err
+		}
+		if fc.got {
+			if err := c.write(ctx, [][]byte{key}, []*chunkWrite{w})[0]; err != nil {
+				return nil, err
+			}
+			return fc.val, nil
+		}
+
+		val, err := c.read(ctx, data)
+		if err == nil {
+			return val, nil
+		}
+		if !errors.Is(err, errChunkMismatch) || !repair {
+			return nil, &DecodeError{key, err}
+		}
+
+		err = c.cache.DelContext(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Chunked) MultiGetOrSet(keys [][]byte, get BatchFallbackGetFunc) []Result {
+	var _get BatchFallbackGetContextFunc
+	if get != nil {
+		_get = func(_ context.Context, keys [][]byte) ([][]byte, error) {
+			return get(keys)
+		}
+	}
+	return c.MultiGetOrSetContext(context.Background(), keys, _get)
+}
+
+func (c *Chunked) MultiGetOrSetContext(ctx context.Context, keys [][]byte, get BatchFallbackGetContextFunc) []Result {
+	var mu sync.Mutex
+	got := make(map[string][]byte)
+	writes := make(map[string]*chunkWrite)
+	var fallback BatchFallbackGetContextFunc
+	if get != nil {
+		fallback = func(ctx context.Context, keys [][]byte) ([][]byte, error) {
+			vals, err := get(ctx, keys)
+			if err != nil || len(vals) != len(keys) {
+				return vals, err
+			}
+
+			datas := make([][]byte, len(vals))
+			ws := make([]*chunkWrite, len(vals))
+			for i := range vals {
+				datas[i], ws[i], err = c.split(vals[i])
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			for i := range keys {
+				got[string(keys[i])] = vals[i]
+				writes[string(keys[i])] = ws[i]
+			}
+			return datas, nil
+		}
+	}
+
+	results := c.cache.MultiGetOrSetContext(ctx, keys, fallback)
+
+	var written [][]byte
+	var ws []*chunkWrite
+	for i := range results {
+		if w := writes[string(keys[i])]; w != nil && results[i].Err == nil {
+			written = append(written, keys[i])
+			ws = append(ws, w)
+			delete(writes, string(keys[i]))
+		}
+	}
+	failed := make(map[string]error)
+	for i, err := range c.write(ctx, written, ws) {
+		if err != nil {
+			failed[string(written[i])] = err
+		}
+	}
+
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+		if err := failed[string(keys[i])]; err != nil {
+			results[i] = Result{Err: err}
+			continue
+		}
+		if val, ok := got[string(keys[i])]; ok {
+			results[i].Val = val
+			continue
+		}
+
+		val, err := c.read(ctx, results[i].Val)
+		if errors.Is(err, errChunkMismatch) {
+			var _get proto.FallbackGetContextFunc
+			if get != nil {
+				_get = func(ctx context.Context, key []byte) ([]byte, error) {
+					return fallbackOne(func(keys [][]byte) ([][]byte, error) {
+						return get(ctx, keys)
+					}, key)
+				}
+			}
+			val, err = c.GetOrSetContext(ctx, keys[i], _get)
+		} else if err != nil {
+			err = &DecodeError{keys[i], err}
+		}
+		results[i] = Result{Val: val, Err: err}
+	}
+	return results
+}
+
+// Del removes the manifest of key, so the chunks are unreachable.
+func (c *Chunked) Del(key []byte) error {
+	return c.cache.Del(key)
+}
+
+func (c *Chunked) DelContext(ctx context.Context, key []byte) error {
+	return c.cache.DelContext(ctx, key)
+}
+
+// Close closes the underlying Cache.
+func (c *Chunked) Close() {
+	c.cache.Close()
+}
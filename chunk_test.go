@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"testing"
+)
+
+func TestChunked(t *testing.T) {
+	memory := NewMemory(KeySizeLimit, TIMEOUT)
+	chunked, err := NewChunked(memory, ChunkConfig{ChunkSize: 4 << 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chunked.Close()
+
+	pool := NewPool(KeySizeLimit, CLIENT_FUZZ_N)
+	t.Run("Repair", testChunkedRepair(chunked, memory, pool))
+	testBasic(t, chunked, pool)
+}
+
+func chunkedManifest(t *testing.T, memory *Memory, tc Case) *chunkManifest {
+	data, err := memory.GetOrSet(tc.Key, badFallbackGet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, m, err := parseChunkEntry(data)
+	if err != nil || m == nil {
+		t.Fatalf("bad manifest, error: %v", err)
+	}
+	return m
+}
+
+func testChunkedRepair(chunked *Chunked, memory *Memory, pool Pool) func(t *testing.T) {
+	return func(t *testing.T) {
+		tc := Case{[]byte("big"), pool.randN(KV_SIZE_LIMIT)}
+		set(t, chunked, tc)
+		hit(t, chunked, tc)
+
+		// missing chunk
+		m := chunkedManifest(t, memory, tc)
+		del(t, memory, Case{m.key(1), nil})
+		check(t, chunked, tc)
+		hit(t, chunked, tc)
+
+		// stale chunk
+		m = chunkedManifest(t, memory, tc)
+		set(t, memory, Case{m.key(2), []byte("stale")})
+		check(t, chunked, tc)
+		hit(t, chunked, tc)
+
+		// Del hides the chunks
+		m = chunkedManifest(t, memory, tc)
+		del(t, chunked, tc)
+		badGetOrSet(t, chunked, tc)
+		_, err := memory.GetOrSet(m.key(0), badFallbackGet)
+		if err != nil {
+			t.Fatalf("chunk is deleted, error: %v", err)
+		}
+	}
+}
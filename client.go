@@ -4,6 +4,8 @@
 package client
 
 import (
+	"context"
+	"io"
 	"math/bits"
 	"time"
 
@@ -13,8 +15,10 @@ import (
 
 type Client struct {
 	timeout time.Duration
+	front
 
 	threads []thread
+	keeper  *keeper
 }
 
 func New(address string, config Config) (*Client, error) {
@@ -23,9 +27,16 @@ func New(address string, config Config) (*Client, error) {
 		return nil, err
 	}
 
+	threads := newThreads(address, config, make([]threadCounters, config.ThreadNR))
+	if config.WarmUp {
+		fill(context.Background(), config.deadline(), threads)
+	}
+
 	return &Client{
 		timeout: config.Timeout,
-		threads: newThreads(address, config)}, nil
+		front:   newFront(config),
+		threads: threads,
+		keeper:  startKeeper(threads, config)}, nil
 }
 
 func (c *Client) dispatch(key []byte) *thread {
@@ -39,15 +50,117 @@ func (c *Client) deadline() time.Time {
 }
 
 func (c *Client) GetOrSet(key []byte, get proto.FallbackGetFunc) ([]byte, error) {
-	return c.dispatch(key).GetOrSet(c.deadline(), key, get)
+	return c.getOrSet(context.Background(), c.deadline(), key, get)
+}
+
+// GetOrSetContext is like GetOrSet, but gives up once ctx is done, get will
+// receive a ctx that is also bounded by Config.Timeout.
+func (c *Client) GetOrSetContext(ctx context.Context, key []byte, get proto.FallbackGetContextFunc) ([]byte, error) {
+	ctx, cancel := context.WithDeadline(ctx, c.deadline())
+	defer cancel()
+
+	deadline, _ := ctx.Deadline()
+	return c.getOrSet(ctx, deadline, key, fallbackWithContext(ctx, get))
+}
+
+func (c *Client) getOrSet(ctx context.Context, deadline time.Time, key []byte, get proto.FallbackGetFunc) ([]byte, error) {
+	return c.front.getOrSet(ctx, key, get, func(get proto.FallbackGetFunc) ([]byte, error) {
+		return c.dispatch(key).GetOrSet(ctx, deadline, key, get)
+	})
+}
+
+// GetOrSetAppend is like GetOrSet, but appends the value to dst, dst is
+// returned on error. A hit makes no allocation if dst has room for the
+// value, and there is no near cache, coalescing or observer.
+func (c *Client) GetOrSetAppend(dst, key []byte, get proto.FallbackGetFunc) ([]byte, error) {
+	if c.front.bypassed() {
+		return c.dispatch(key).GetOrSetAppend(context.Background(), c.deadline(), dst, key, get)
+	}
+
+	val, err := c.GetOrSet(key, get)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, val...), nil
+}
+
+// MultiGetOrSet looks up keys concurrently by thread, get is called once
+// with all keys missed, and again only for threads held up by other batches.
+func (c *Client) MultiGetOrSet(keys [][]byte, get BatchFallbackGetFunc) []Result {
+	return c.multiGetOrSet(context.Background(), c.deadline(), keys, get)
+}
+
+func (c *Client) MultiGetOrSetContext(ctx context.Context, keys [][]byte, get BatchFallbackGetContextFunc) []Result {
+	ctx, cancel := context.WithDeadline(ctx, c.deadline())
+	defer cancel()
+
+	deadline, _ := ctx.Deadline()
+	return c.multiGetOrSet(ctx, deadline, keys, batchFallbackWithContext(ctx, get))
+}
+
+func (c *Client) multiGetOrSet(ctx context.Context, deadline time.Time, keys [][]byte, get BatchFallbackGetFunc) []Result {
+	return c.front.multiGetOrSet(keys, get, func(b *batch, get BatchFallbackGetFunc) {
+		groups := make(map[*thread][]batchKey)
+		for _, i := range b.unique {
+			t := c.dispatch(keys[i])
+			groups[t] = append(groups[t], batchKey{keys[i], i})
+		}
+
+		b.run(ctx, deadline, groups, get)
+	})
+}
+
+// GetOrSetStream is like GetOrSetContext, but the value is read from the
+// returned reader, directly from the connection on a hit, and from the
+// fallback on a miss while it is set. The reader must be closed, the
+// connection is reused only if the value is read out. Config.Timeout
+// bounds the request and every read, and ctx bounds the reader too.
+//
+// Note: the Observer, the near cache and the coalescing are bypassed.
+func (c *Client) GetOrSetStream(ctx context.Context, key []byte, get StreamFallbackGetFunc) (io.ReadCloser, int64, error) {
+	s, err := c.dispatch(key).GetOrSetStream(ctx, c.deadline(), c.timeout, key, get)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s, s.left, nil
 }
 
 func (c *Client) Del(key []byte) error {
-	return c.dispatch(key).Del(c.deadline(), key)
+	return c.del(context.Background(), c.deadline(), key)
+}
+
+// DelContext is like Del, but gives up once ctx is done.
+func (c *Client) DelContext(ctx context.Context, key []byte) error {
+	ctx, cancel := context.WithDeadline(ctx, c.deadline())
+	defer cancel()
+
+	deadline, _ := ctx.Deadline()
+	return c.del(ctx, deadline, key)
+}
+
+func (c *Client) del(ctx context.Context, deadline time.Time, key []byte) error {
+	return c.front.del(key, func() error {
+		return c.dispatch(key).Del(ctx, deadline, key)
+	})
+}
+
+func (c *Client) NearCacheStats() NearCacheStats {
+	return c.near.Stats()
 }
 
 func (c *Client) Close() {
+	c.keeper.Stop()
 	for i := range c.threads {
 		c.threads[i].Close()
 	}
 }
+
+func fallbackWithContext(ctx context.Context, get proto.FallbackGetContextFunc) proto.FallbackGetFunc {
+	if get == nil {
+		return nil
+	}
+
+	return func(key []byte) ([]byte, error) {
+		return get(ctx, key)
+	}
+}
@@ -4,9 +4,17 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
 	"math"
 	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/imchuncai/umem-cache-client-Go/proto"
 )
@@ -34,6 +42,18 @@ func TestClient(t *testing.T) {
 
 	t.Run("TooManyConnections", testClientTooManyConnections(param))
 	t.Run("Timeout", testClientTimeout(client))
+	t.Run("Context", testClientContext(client))
+	t.Run("Coalesce", testClientCoalesce(param))
+	t.Run("CoalescePanic", testClientCoalescePanic(param))
+	t.Run("NearCache", testClientNearCache(client, param))
+	t.Run("Observer", testClientObserver(param))
+	t.Run("Chunked", testClientChunked(client))
+	t.Run("ChunkedOneConn", testClientChunkedOneConn(param))
+	t.Run("Stream", testStream(client))
+	t.Run("Append", testClientAppend(client))
+	t.Run("Pool", testClientPool(param))
+	t.Run("Stats", testClientStats(param))
+	t.Run("Dialer", testClientDialer(param))
 
 	// Note: if we run basic test on t.Failed(), previous fail log will be wiped
 	if !t.Failed() {
@@ -60,14 +80,14 @@ func testClientTooManyConnections(param TestParam) func(t *testing.T) {
 		}()
 
 		for i := 0; i < THREAD_MAX_CONN; i++ {
-			conn, err := proto.DialCache(deadline, address, 0, param.Config.TLSConfig)
+			conn, err := proto.DialCacheWithDialer(deadline, address, 0, param.Config.Dialer())
 			if err != nil {
 				t.Fatal(err)
 			}
 			conns = append(conns, conn)
 		}
 
-		conn, err := proto.DialCache(deadline, address, 0, param.Config.TLSConfig)
+		conn, err := proto.DialCacheWithDialer(deadline, address, 0, param.Config.Dialer())
 		if err == nil {
 			conn.Close()
 		}
@@ -110,3 +130,739 @@ func testClientTimeout(client *Client) func(t *testing.T) {
 		check(t, client, tc)
 	}
 }
+
+func testClientContext(client *Client) func(t *testing.T) {
+	return func(t *testing.T) {
+		tc := Case{
+			[]byte("hello"),
+			[]byte("world"),
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		fallbackGet := func(ctx context.Context, key []byte) ([]byte, error) {
+			cancel()
+			<-ctx.Done()
+			return tc.Val, ctx.Err()
+		}
+
+		del(t, client, tc)
+		_, err := client.GetOrSetContext(ctx, tc.Key, fallbackGet)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("want error: %v, got error: %v", context.Canceled, err)
+		}
+
+		err = client.DelContext(ctx, tc.Key)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("want error: %v, got error: %v", context.Canceled, err)
+		}
+
+		tc.Val = nil
+		check(t, client, tc)
+	}
+}
+
+func testClientCoalesce(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		config := param.Config
+		config.Coalesce = true
+		client, err := New(MachineAddress(CLIENT_PORT), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		tc := Case{[]byte("coalesce"), []byte("world")}
+		tc2 := Case{tc.Key, []byte("world2")}
+		// a failed GetOrSet on an idle connection is tried again on a new one
+		other, err := New(MachineAddress(CLIENT_PORT), param.Config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		del(t, other, tc)
+		other.Close()
+
+		// the fallback is called once for concurrent callers, a caller not
+		// coalesced would call it again after the failure of the first
+		var calls atomic.Int32
+		errFallback := errors.New("fallback failed")
+		release := make(chan struct{})
+		countFallbackGet := func(key []byte) ([]byte, error) {
+			calls.Add(1)
+			<-release
+			return nil, errFallback
+		}
+
+		const callers = 16
+		var wg, started sync.WaitGroup
+		wg.Add(callers)
+		started.Add(callers)
+		for range callers {
+			go func() {
+				defer wg.Done()
+
+				started.Done()
+				_, err := client.GetOrSet(tc.Key, countFallbackGet)
+				if !errors.Is(err, errFallback) {
+					t.Errorf("want error: %v, got: %v", errFallback, err)
+				}
+			}()
+		}
+		started.Wait()
+		for calls.Load() == 0 {
+			nap()
+		}
+		nap()
+		close(release)
+		wg.Wait()
+		if n := calls.Load(); n != 1 {
+			t.Fatalf("want 1 fallback call, got: %d", n)
+		}
+
+		populating := make(chan struct{})
+		release = make(chan struct{})
+		get := func(get proto.FallbackGetFunc, want []byte) {
+			defer wg.Done()
+
+			val, err := client.GetOrSet(tc.Key, get)
+			if err != nil {
+				t.Error(err)
+			} else if string(val) != string(want) {
+				t.Errorf("want: %s, got: %s", want, val)
+			}
+		}
+		wg.Add(1)
+		go get(func(key []byte) ([]byte, error) {
+			close(populating)
+			<-release
+			return tc.Val, nil
+		}, tc.Val)
+		<-populating
+
+		// callers after Del should not share the value populated before
+		del(t, client, tc)
+		populating2 := make(chan struct{})
+		wg.Add(1)
+		go get(func(key []byte) ([]byte, error) {
+			close(populating2)
+			return tc2.Val, nil
+		}, tc2.Val)
+		<-populating2
+
+		close(release)
+		wg.Wait()
+
+		// one for the coalesced GetOrSet, and one shared by Del and the last
+		if n := client.dispatch(tc.Key).stats().IdleConns; n != 2 {
+			t.Fatalf("want 2 connections, got: %d", n)
+		}
+		check(t, client, tc2)
+	}
+}
+
+func testClientCoalescePanic(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		config := param.Config
+		config.Coalesce = true
+		client, err := New(MachineAddress(CLIENT_PORT), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		tc := Case{[]byte("coalesce-panic"), []byte("world")}
+		del(t, client, tc)
+
+		populating := make(chan struct{})
+		release := make(chan struct{})
+		panicked := make(chan struct{})
+		go func() {
+			defer func() {
+				recover()
+				close(panicked)
+			}()
+			client.GetOrSet(tc.Key, func(key []byte) ([]byte, error) {
+				close(populating)
+				<-release
+				panic("fallback")
+			})
+		}()
+		<-populating
+
+		// a caller not coalesced would call its fallback
+		var calls atomic.Int32
+		started := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			close(started)
+			_, err := client.GetOrSet(tc.Key, func(key []byte) ([]byte, error) {
+				calls.Add(1)
+				return tc.Val, nil
+			})
+			done <- err
+		}()
+		<-started
+		nap()
+		close(release)
+
+		if err := <-done; !errors.Is(err, errFlightPanicked) {
+			t.Fatalf("want error: %v, got: %v", errFlightPanicked, err)
+		}
+		<-panicked
+		if n := calls.Load(); n != 0 {
+			t.Fatalf("want no fallback call, got: %d", n)
+		}
+		check(t, client, tc)
+	}
+}
+
+func testClientNearCache(other *Client, param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		const ttl = 200 * time.Millisecond
+
+		config := param.Config
+		config.NearCacheSize = 1 << 20
+		config.NearCacheTTL = ttl
+		client, err := New(MachineAddress(CLIENT_PORT), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		tc := Case{[]byte("near"), []byte("world")}
+		tc2 := Case{tc.Key, []byte("world2")}
+		set(t, client, tc)
+
+		set(t, other, tc2)
+		check(t, client, tc)
+		stats := client.NearCacheStats()
+		if stats.Hits != 1 || stats.Entries != 1 {
+			t.Fatalf("bad stats: %+v", stats)
+		}
+
+		del(t, client, tc)
+		check(t, client, tc)
+
+		set(t, other, tc2)
+		time.Sleep(ttl)
+		check(t, client, tc2)
+	}
+}
+
+type recordObserver struct {
+	NopObserver
+
+	mu          sync.Mutex
+	operations  []OperationEvent
+	dials       int
+	ticketWaits int
+	rebuilds    int
+	// onConnClose is called without holding mu
+	onConnClose func()
+}
+
+func (o *recordObserver) OnConnClose(address string, threadID uint32, err error) {
+	o.mu.Lock()
+	f := o.onConnClose
+	o.mu.Unlock()
+
+	if f != nil {
+		f()
+	}
+}
+
+func (o *recordObserver) OnTicketWait(address string, threadID uint32, wait time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.ticketWaits++
+}
+
+func (o *recordObserver) OnClusterRebuild(cluster proto.Cluster, leader string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.rebuilds++
+}
+
+func (o *recordObserver) OnOperation(e OperationEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.operations = append(o.operations, e)
+}
+
+func (o *recordObserver) OnDial(address string, threadID uint32, duration time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.dials++
+}
+
+func testClientObserver(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		observer := &recordObserver{}
+		config := param.Config
+		config.Observer = observer
+		client, err := New(MachineAddress(CLIENT_PORT), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		tc := Case{[]byte("observer"), []byte("world")}
+		set(t, client, tc)
+		check(t, client, tc)
+
+		want := []OperationEvent{
+			{Op: OpDel, KeySize: len(tc.Key)},
+			{Op: OpGetOrSet, KeySize: len(tc.Key), ValSize: len(tc.Val)},
+			{Op: OpGetOrSet, KeySize: len(tc.Key), ValSize: len(tc.Val), Hit: true},
+		}
+		if len(observer.operations) != len(want) {
+			t.Fatalf("want %d operations, got: %d", len(want), len(observer.operations))
+		}
+		for i, e := range observer.operations {
+			if e.Op != want[i].Op || e.KeySize != want[i].KeySize ||
+				e.ValSize != want[i].ValSize || e.Hit != want[i].Hit || e.Err != nil {
+				t.Fatalf("want: %+v, got: %+v", want[i], e)
+			}
+		}
+		if observer.operations[1].Fallback <= 0 {
+			t.Fatal("fallback is not observed")
+		}
+		if observer.dials != 1 {
+			t.Fatalf("want 1 dial, got: %d", observer.dials)
+		}
+		// tickets available at once are observed too
+		if observer.ticketWaits != len(want) {
+			t.Fatalf("want %d ticket waits, got: %d", len(want), observer.ticketWaits)
+		}
+
+		// the observer can take stats while connections are closed
+		observer.mu.Lock()
+		observer.onConnClose = func() { client.Stats() }
+		observer.mu.Unlock()
+		client.Close()
+	}
+}
+
+func testClientChunked(client *Client) func(t *testing.T) {
+	return func(t *testing.T) {
+		chunked, err := NewChunked(client, ChunkConfig{ChunkSize: KV_SIZE_LIMIT / 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pool := NewPool(CLIENT_KEY_MAX_SIZE, CLIENT_FUZZ_N)
+		val := make([]byte, 0, 3*KV_SIZE_LIMIT)
+		for len(val) < cap(val) {
+			val = append(val, pool.randN(KV_SIZE_LIMIT)...)
+		}
+		tc := Case{[]byte("chunked"), val}
+		set(t, chunked, tc)
+		hit(t, chunked, tc)
+	}
+}
+
+// testClientChunkedOneConn writes chunks on the thread of the key, they must
+// not wait on the ticket held for the key.
+func testClientChunkedOneConn(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		config := param.Config
+		config.MaxConnsPerThread = 1
+		client, err := New(MachineAddress(CLIENT_PORT), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		// 64 chunks, some are on the thread of the key for sure
+		chunked, err := NewChunked(client, ChunkConfig{ChunkSize: 64})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pool := NewPool(CLIENT_KEY_MAX_SIZE, CLIENT_FUZZ_N)
+		tc := Case{[]byte("chunked-one-conn"), pool.randN(64 * 64)}
+		tc2 := Case{[]byte("chunked-one-conn-2"), pool.randN(64 * 64)}
+		del(t, chunked, tc)
+		del(t, chunked, tc2)
+
+		start := time.Now()
+		set(t, chunked, tc)
+		results := chunked.MultiGetOrSet([][]byte{tc2.Key}, func(keys [][]byte) ([][]byte, error) {
+			return [][]byte{tc2.Val}, nil
+		})
+		if results[0].Err != nil || !bytes.Equal(results[0].Val, tc2.Val) {
+			t.Fatalf("want: %v, got: %v", tc2, results[0])
+		}
+		if elapsed := time.Since(start); elapsed >= TCP_TIMEOUT {
+			t.Fatalf("chunks wait on the ticket of the key: %v", elapsed)
+		}
+		hit(t, chunked, tc)
+		hit(t, chunked, tc2)
+	}
+}
+
+type streamCache interface {
+	GetOrSetStream(ctx context.Context, key []byte, get StreamFallbackGetFunc) (io.ReadCloser, int64, error)
+}
+
+func readStream(t *testing.T, cache streamCache, tc Case, get StreamFallbackGetFunc) {
+	r, size, err := cache.GetOrSetStream(context.Background(), tc.Key, get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	val, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(tc.Val)) || !bytes.Equal(val, tc.Val) {
+		t.Fatalf("want: %v, got size: %d, read size: %d", tc, size, len(val))
+	}
+}
+
+func testStream(cache streamCache) func(t *testing.T) {
+	return func(t *testing.T) {
+		pool := NewPool(CLUSTER_KEY_SIZE_LIMIT, CLIENT_FUZZ_N)
+		tc := Case{[]byte("stream"), pool.randN(KV_SIZE_LIMIT)}
+		del(t, cache.(Cache), tc)
+
+		get := func(ctx context.Context, key []byte) (io.Reader, int64, error) {
+			if !bytes.Equal(key, tc.Key) {
+				t.Errorf("fallback got key: %q", key)
+			}
+			return bytes.NewReader(tc.Val), int64(len(tc.Val)), nil
+		}
+		readStream(t, cache, tc, get)
+		hit(t, cache.(Cache), tc)
+
+		badGet := func(ctx context.Context, key []byte) (io.Reader, int64, error) {
+			return nil, 0, errBadFallbackGet
+		}
+		readStream(t, cache, tc, badGet)
+
+		// closed early
+		r, _, err := cache.GetOrSetStream(context.Background(), tc.Key, badGet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = r.Read(make([]byte, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		readStream(t, cache, tc, badGet)
+
+		// short reader of the fallback abandons the value
+		short := Case{[]byte("short"), nil}
+		del(t, cache.(Cache), short)
+		r, _, err = cache.GetOrSetStream(context.Background(), short.Key, func(ctx context.Context, key []byte) (io.Reader, int64, error) {
+			return bytes.NewReader(tc.Val[:10]), 11, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.ReadAll(r)
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("want error: %v, got error: %v", io.ErrUnexpectedEOF, err)
+		}
+		r.Close()
+		badGetOrSet(t, cache.(Cache), short)
+	}
+}
+
+func testClientAppend(client *Client) func(t *testing.T) {
+	return func(t *testing.T) {
+		tc := Case{[]byte("append"), []byte("world")}
+		del(t, client, tc)
+
+		val, err := client.GetOrSetAppend([]byte("hello "), tc.Key, fallbackGet(tc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(val) != "hello world" {
+			t.Fatalf("want: hello world, got: %q", val)
+		}
+
+		val, err = client.GetOrSetAppend([]byte("hi "), tc.Key, badFallbackGet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(val) != "hi world" {
+			t.Fatalf("want: hi world, got: %q", val)
+		}
+
+		// the stub makes no allocation, so only the client is counted
+		stub, err := New(runStubHitServer(t, tc.Val), Config{Timeout: TIMEOUT, ThreadNR: THREAD_NR})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stub.Close()
+
+		buf := make([]byte, 0, 64)
+		allocs := testing.AllocsPerRun(100, func() {
+			_, err = stub.GetOrSetAppend(buf[:0], tc.Key, badFallbackGet)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allocs != 0 {
+			t.Fatalf("hit allocates %v times", allocs)
+		}
+	}
+}
+
+// runStubHitServer serves every GetOrSet by a hit of val, and makes no
+// allocation for a request.
+func runStubHitServer(t testing.TB, val []byte) string {
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	res := binary.LittleEndian.AppendUint64(nil, uint64(len(val)))
+	res = append(res, 0)
+	res = append(res, val...)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveStubHit(conn, res)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveStubHit(conn net.Conn, res []byte) {
+	defer conn.Close()
+
+	buf := make([]byte, 2+math.MaxUint8)
+	// connect
+	_, err := io.ReadFull(conn, buf[:8])
+	if err == nil {
+		_, err = conn.Write([]byte{0})
+	}
+	for err == nil {
+		_, err = io.ReadFull(conn, buf[:2])
+		if err == nil {
+			_, err = io.ReadFull(conn, buf[2:2+buf[1]])
+		}
+		if err == nil {
+			_, err = conn.Write(res)
+		}
+	}
+}
+
+func BenchmarkClientGetOrSetAppend(b *testing.B) {
+	tc := Case{[]byte("bench"), make([]byte, 1024)}
+	client, err := New(runStubHitServer(b, tc.Val), Config{Timeout: TIMEOUT, ThreadNR: THREAD_NR})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer client.Close()
+
+	buf := make([]byte, 0, len(tc.Val))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		_, err := client.GetOrSetAppend(buf[:0], tc.Key, badFallbackGet)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func idleConns(client *Client) []int {
+	var idle []int
+	for _, t := range client.Stats().Members[0].Threads {
+		idle = append(idle, t.IdleConns)
+	}
+	return idle
+}
+
+func testClientPool(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		const timeout = 100 * time.Millisecond
+
+		config := param.Config
+		config.MinIdleConnsPerThread = 2
+		config.WarmUp = true
+		client, err := New(MachineAddress(CLIENT_PORT), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		for _, n := range idleConns(client) {
+			if n != 2 {
+				t.Fatalf("want 2 idle connections after warm-up, got: %v", idleConns(client))
+			}
+		}
+
+		config = param.Config
+		config.IdleConnTimeout = timeout
+		client2, err := New(MachineAddress(CLIENT_PORT), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client2.Close()
+
+		tc := Case{[]byte("pool"), []byte("world")}
+		set(t, client2, tc)
+		if n := client2.dispatch(tc.Key).stats().IdleConns; n != 1 {
+			t.Fatalf("want 1 idle connection, got: %d", n)
+		}
+		deadline := DEADLINE()
+		for client2.dispatch(tc.Key).stats().IdleConns != 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("want idle connection closed")
+			}
+			nap()
+		}
+
+		observer := &recordObserver{}
+		config = param.Config
+		config.MaxConnLifetime = timeout
+		config.MinIdleConnsPerThread = 1
+		config.Observer = observer
+		client3, err := New(MachineAddress(CLIENT_PORT), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client3.Close()
+
+		deadline = DEADLINE()
+		for {
+			observer.mu.Lock()
+			dials := observer.dials
+			observer.mu.Unlock()
+			if dials > config.ThreadNR {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("want connections redialed after MaxConnLifetime, got %d dials", dials)
+			}
+			nap()
+		}
+		check(t, client3, tc)
+	}
+}
+
+func testClientStats(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		config := param.Config
+		config.MaxConnsPerThread = 2
+		client, err := New(MachineAddress(CLIENT_PORT), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		tc := Case{[]byte("stats"), []byte("world")}
+		set(t, client, tc)
+
+		th := client.dispatch(tc.Key)
+		stats := th.stats()
+		if stats.Dials != 1 || stats.DialFailures != 0 || stats.ErrorCloses != 0 ||
+			stats.IdleConns != 1 || stats.TicketsInUse != 0 || stats.MaxConns != 2 ||
+			stats.Tickets != 2 {
+			t.Fatalf("bad stats: %+v", stats)
+		}
+
+		// the ticket is waited for
+		const wait = 50 * time.Millisecond
+		th.tryAcquireTicket()
+		th.tryAcquireTicket()
+		go func() {
+			time.Sleep(wait)
+			th.releaseTicket()
+			th.releaseTicket()
+		}()
+		hit(t, client, tc)
+		stats = th.stats()
+		if stats.Tickets != 3 || stats.TicketWait < wait {
+			t.Fatalf("bad stats: %+v", stats)
+		}
+
+		// the wait of a failed acquisition is not counted
+		th.tryAcquireTicket()
+		th.tryAcquireTicket()
+		ctx, cancel := context.WithTimeout(context.Background(), wait)
+		_, err = client.GetOrSetContext(ctx, tc.Key, nil)
+		cancel()
+		th.releaseTicket()
+		th.releaseTicket()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("want error: %v, got: %v", context.DeadlineExceeded, err)
+		}
+		if got := th.stats(); got.Tickets != stats.Tickets || got.TicketWait != stats.TicketWait {
+			t.Fatalf("want stats: %+v, got: %+v", stats, got)
+		}
+
+		del(t, client, tc)
+		badGetOrSet(t, client, tc)
+		stats = client.dispatch(tc.Key).stats()
+		if stats.ErrorCloses == 0 || stats.Dials-stats.ErrorCloses != uint64(stats.IdleConns) {
+			t.Fatalf("bad stats: %+v", stats)
+		}
+
+		listener, err := net.Listen("tcp6", "[::1]:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		address := listener.Addr().String()
+		listener.Close()
+
+		bad, err := New(address, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer bad.Close()
+
+		_, err = bad.GetOrSet(tc.Key, fallbackGet(tc))
+		if err == nil {
+			t.Fatal("want dial failure")
+		}
+		stats = bad.dispatch(tc.Key).stats()
+		if stats.Dials != 1 || stats.DialFailures != 1 {
+			t.Fatalf("bad stats: %+v", stats)
+		}
+	}
+}
+
+func testClientDialer(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		var mu sync.Mutex
+		var networks []string
+		config := param.Config
+		config.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			mu.Lock()
+			networks = append(networks, network)
+			mu.Unlock()
+
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		}
+		client, err := New(MachineAddress(CLIENT_PORT), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		tc := Case{[]byte("dialer"), []byte("world")}
+		set(t, client, tc)
+		check(t, client, tc)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(networks) != 1 || networks[0] != "tcp" {
+			t.Fatalf("want one tcp dial, got: %v", networks)
+		}
+	}
+}
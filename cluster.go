@@ -5,11 +5,12 @@ package client
 
 import (
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"math/bits"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
@@ -21,15 +22,25 @@ var errClosed = errors.New("cluster is closed")
 
 type Cluster struct {
 	config Config
+	// seeds are the addresses passed to NewCluster, hostnames of them are
+	// resolved again on rebuild, in case all members have moved.
+	seeds []string
+	front
+	degraded  *degraded
+	watchers  watchers
+	refresher *refresher
 
 	mu       sync.RWMutex
 	closed   bool
 	updating bool
 
 	version   uint64
+	_type     proto.ClusterType
+	machines  []proto.Machine
 	leader    string
 	authority *authority
 	members   []member
+	counters  memberCounters
 }
 
 // annoying stupid DeadlineExceeded
@@ -44,39 +55,47 @@ func NewCluster(addresses []string, config Config) (*Cluster, error) {
 	}
 
 	deadline := config.deadline()
-	leader, cluster, authority, err := leaderClusterAuthority(deadline, addresses, config.TLSConfig)
+	leader, cluster, authority, err := leaderClusterAuthority(deadline, addresses, config.Admin())
 	if err != nil {
 		return nil, err
 	}
 
-	return &Cluster{
+	c := &Cluster{
 		config:    config,
+		seeds:     slices.Clone(addresses),
+		front:     newFront(config),
 		closed:    false,
 		updating:  false,
 		version:   cluster.Version,
+		_type:     cluster.Type,
+		machines:  cluster.Machines,
 		leader:    leader,
-		authority: newAuthority(authority),
-		members:   newMembers(cluster.Machines, config),
-	}, nil
+		authority: newAuthority(authority, leader, config.Logger),
+	}
+	c.counters = c.counters.renew(cluster.Machines, config.ThreadNR)
+	c.members = newMembers(cluster.Machines, config, config.WarmUp, c.counters)
+	c.degraded = newDegraded(config, c.replayDel)
+	c.refresher = c.startRefresher()
+	return c, nil
 }
 
-func leaderClusterAuthority(deadline time.Time, addresses []string, config *tls.Config) (string, proto.Cluster, *proto.AuthorityConn, error) {
-	for {
-		leader, cluster, err := AdminLeaderCluster(deadline, addresses, config)
+func leaderClusterAuthority(deadline time.Time, addresses []string, config AdminConfig) (string, proto.Cluster, *proto.AuthorityConn, error) {
+	for attempt := 1; ; attempt++ {
+		leader, cluster, err := AdminLeaderClusterWithConfig(deadline, addresses, config)
 		if err != nil {
 			return "", proto.Cluster{}, nil, err
 		}
 
 		var authority *proto.AuthorityConn
-		authority, err = proto.DialAuthority(deadline, leader, config)
+		authority, err = proto.DialAuthorityWithDialer(deadline, leader, config.Dialer)
 		if err == nil {
 			return leader, cluster, authority, nil
 		}
-		if errIsIOTimeout(err) {
+		if !config.Retry.retry(attempt, err) {
 			return "", proto.Cluster{}, nil, err
 		}
 
-		nap()
+		config.Retry.sleepDeadline(deadline, attempt)
 	}
 }
 
@@ -90,41 +109,104 @@ func (c *Cluster) rebuild(version uint64) {
 
 	c.updating = true
 	go func() {
+		var e TopologyEvent
 		defer func() {
 			c.mu.Lock()
 			defer c.mu.Unlock()
 
 			c.updating = false
+			// queued under c.mu, so that the events keep the order of the
+			// updates
+			if e.changed() {
+				c.watchers.notify(e)
+			}
 			if c.closed {
 				c.__close()
 			}
 		}()
 
-		addrs := make([]string, len(c.members))
-		for i := range c.members {
-			addrs[i] = c.members[i].address
+		leader, cluster, authority, err := leaderClusterAuthority(time.Time{}, c.__addresses(), c.config.Admin())
+		if err != nil {
+			if c.config.Observer != nil {
+				c.config.Observer.OnClusterRebuild(cluster, leader, err)
+			}
+			c.config.Logger.Warn("rebuild cluster failed", logLeader, c.leader, logVersion, version, "error", err)
+			return
 		}
 
-		leader, cluster, authority, _ := leaderClusterAuthority(time.Time{}, addrs, c.config.TLSConfig)
+		c.mu.Lock()
+		e = c.__update(leader, cluster, authority)
+		c.mu.Unlock()
 
-		// a cluster member is not working well, but cluster is not detected that yet.
-		// we should not make the decision to rebuild authority.
-		if cluster.Version == c.version && leader == c.leader && !c.authority.Closed() {
-			return
+		if e.changed() && c.config.Observer != nil {
+			c.config.Observer.OnClusterRebuild(cluster, leader, nil)
 		}
+	}()
+}
 
-		c.leader = leader
-		c.authority.Close()
-		c.authority = newAuthority(authority)
+// __addresses returns the addresses to request the cluster from.
+func (c *Cluster) __addresses() []string {
+	addrs := make([]string, len(c.members), len(c.members)+len(c.seeds))
+	for i := range c.members {
+		addrs[i] = c.members[i].address
+	}
+	for _, seed := range c.seeds {
+		if !slices.Contains(addrs, seed) {
+			addrs = append(addrs, seed)
+		}
+	}
+	return addrs
+}
 
-		if c.version != cluster.Version {
-			c.version = cluster.Version
-			for i := range c.members {
-				c.members[i].Close()
-			}
-			c.members = newMembers(cluster.Machines, c.config)
+// __update returns the topology change observed.
+func (c *Cluster) __update(leader string, cluster proto.Cluster, authority *proto.AuthorityConn) TopologyEvent {
+	log := c.config.Logger
+	e := TopologyEvent{
+		Old:       proto.Cluster{Type: c._type, Version: c.version, Machines: c.machines},
+		New:       cluster,
+		OldLeader: c.leader,
+		NewLeader: leader,
+	}
+	c.machines = cluster.Machines
+	if cluster.Type != c._type {
+		log.Info("cluster type changed", logVersion, cluster.Version,
+			"old_type", c._type.String(), logType, cluster.Type.String())
+		c._type = cluster.Type
+	}
+
+	// a cluster member is not working well, but cluster is not detected that yet.
+	// we should not make the decision to rebuild authority.
+	if cluster.Version == c.version && leader == c.leader && !c.authority.Closed() {
+		log.Debug("cluster unchanged", logLeader, leader, logVersion, cluster.Version)
+		authority.Close()
+		return e
+	}
+
+	if leader != c.leader {
+		log.Info("cluster leader changed", logVersion, cluster.Version,
+			"old_leader", c.leader, logLeader, leader)
+		c.leader = leader
+	}
+	c.authority.Close()
+	c.authority = newAuthority(authority, leader, log)
+	log.Debug("authority rebuilt", logLeader, leader, logVersion, cluster.Version)
+
+	if c.version != cluster.Version {
+		log.Info("cluster version changed", logLeader, leader,
+			"old_version", c.version, logVersion, cluster.Version)
+		c.near.flush()
+		c.version = cluster.Version
+		for i := range c.members {
+			c.members[i].Close()
 		}
-	}()
+		c.counters = c.counters.renew(cluster.Machines, c.config.ThreadNR)
+		c.members = newMembers(cluster.Machines, c.config, false, c.counters)
+		for i := range c.members {
+			log.Info("member rebuilt", logVersion, cluster.Version,
+				logAddress, c.members[i].address, "route", c.members[i].threads[0].route)
+		}
+	}
+	return e
 }
 
 func (c *Cluster) auth() (uint64, *authority, []member, error) {
@@ -142,7 +224,14 @@ func (c *Cluster) auth() (uint64, *authority, []member, error) {
 	return c.version, c.authority, c.members, nil
 }
 
-func (c *Cluster) doOnce(ctx context.Context, deadline time.Time, h1, h2 uint64, f func(m member, threadID uint64) error) (uint64, error) {
+func (c *Cluster) route(members []member, key []byte) (*member, uint64) {
+	h1, h2 := murmur3.SeedSum128(74, 74, key)
+	m := &members[h2&uint64(len(members)-1)]
+	hi, _ := bits.Mul64(h1, uint64(c.config.ThreadNR))
+	return m, hi
+}
+
+func (c *Cluster) doOnce(ctx context.Context, deadline time.Time, f func(version uint64, members []member) error) (uint64, error) {
 	version, auth, members, err := c.auth()
 	if err != nil {
 		return 0, err
@@ -153,16 +242,14 @@ func (c *Cluster) doOnce(ctx context.Context, deadline time.Time, h1, h2 uint64,
 		return version, err
 	}
 
-	m := members[h2&uint64(len(members)-1)]
-	hi, _ := bits.Mul64(h1, uint64(c.config.ThreadNR))
-	err = f(m, hi)
+	err = f(version, members)
 	if err != nil {
 		return version, err
 	}
 
 	select {
 	case <-ctx.Done():
-		return 0, os.ErrDeadlineExceeded
+		return 0, ctx.Err()
 	case v2 := <-ch:
 		if v2 == version {
 			return 0, nil
@@ -171,45 +258,340 @@ func (c *Cluster) doOnce(ctx context.Context, deadline time.Time, h1, h2 uint64,
 	}
 }
 
-func (c *Cluster) do(deadline time.Time, key []byte, f func(m member, threadID uint64) error) error {
-	ctx, cancel := context.WithDeadline(context.Background(), deadline)
-	defer cancel()
-
-	h1, h2 := murmur3.SeedSum128(74, 74, key)
-	for ctx.Err() == nil {
-		version, err := c.doOnce(ctx, deadline, h1, h2, f)
-		if err == nil || errIsIOTimeout(err) || errors.Is(err, proto.ErrClientSide) || errors.Is(err, errClosed) {
+// do calls f with the cluster version of the attempt until it succeeds under
+// the same cluster version, ctx should be bounded by deadline.
+func (c *Cluster) do(ctx context.Context, deadline time.Time, f func(version uint64, members []member) error) error {
+	for attempt := 1; ctx.Err() == nil; attempt++ {
+		version, err := c.doOnce(ctx, deadline, f)
+		if err == nil || !c.config.Retry.retry(attempt, err) {
 			return err
 		}
+		if ctx.Err() != nil {
+			break
+		}
 
-		nap()
+		if c.config.Observer != nil {
+			c.config.Observer.OnRetry(attempt, err)
+		}
+
+		c.config.Retry.sleep(ctx, attempt)
 		c.rebuild(version)
 	}
 	return ctx.Err()
 }
 
+func (c *Cluster) doKey(ctx context.Context, deadline time.Time, key []byte, f func(m *member, threadID uint64) error) error {
+	return c.do(ctx, deadline, func(_ uint64, members []member) error {
+		m, threadID := c.route(members, key)
+		return m.breaker.call(ctx, m.address, func() error {
+			return f(m, threadID)
+		})
+	})
+}
+
+// failOpen reports whether the fallback should be called directly for err.
+func (c *Cluster) failOpen(err error) bool {
+	return c.config.Breaker.FailOpen && errors.Is(err, ErrCircuitOpen)
+}
+
 func (c *Cluster) deadline() time.Time {
 	return c.config.deadline()
 }
 
+func (c *Cluster) withDeadline(ctx context.Context) (context.Context, time.Time, context.CancelFunc) {
+	ctx, cancel := context.WithDeadlineCause(ctx, c.deadline(), errTimeout)
+	deadline, _ := ctx.Deadline()
+	return ctx, deadline, cancel
+}
+
 func (c *Cluster) Del(key []byte) error {
-	deadline := c.deadline()
+	return c.DelContext(context.Background(), key)
+}
+
+// DelContext is like Del, but gives up once ctx is done.
+func (c *Cluster) DelContext(ctx context.Context, key []byte) error {
+	ctx, deadline, cancel := c.withDeadline(ctx)
+	defer cancel()
 
-	return c.do(deadline, key, func(m member, threadID uint64) error {
-		return m.Del(deadline, threadID, key)
+	return c.front.del(key, func() error {
+		err := c.doKey(ctx, deadline, key, func(m *member, threadID uint64) error {
+			return m.Del(ctx, deadline, threadID, key)
+		})
+		return c.degraded.del(key, err)
 	})
 }
 
+// replayDel replays a Del queued in degraded mode. Unless probe, it fails
+// fast on a member taken as down, instead of waiting for the timeout.
+func (c *Cluster) replayDel(ctx context.Context, key []byte, probe bool) error {
+	if !probe {
+		if _, _, members, err := c.auth(); err == nil {
+			if m, _ := c.route(members, key); m.replayFailed.Load() {
+				return fmt.Errorf("%w: %s", errMemberDown, m.address)
+			}
+		}
+	}
+
+	ctx, deadline, cancel := c.withDeadline(ctx)
+	defer cancel()
+
+	err := c.doKey(ctx, deadline, key, func(m *member, threadID uint64) error {
+		err := m.Del(ctx, deadline, threadID, key)
+		m.replayFailed.Store(breakerFailure(ctx, err))
+		return err
+	})
+	// the value may be populated by the fallback before the replay
+	c.front.invalidate(key)
+	return err
+}
+
 func (c *Cluster) GetOrSet(key []byte, fallbackGet proto.FallbackGetFunc) (val []byte, err error) {
-	deadline := c.deadline()
+	ctx, deadline, cancel := c.withDeadline(context.Background())
+	defer cancel()
+
+	return c.getOrSet(ctx, deadline, key, fallbackGet)
+}
+
+// GetOrSetContext is like GetOrSet, but gives up once ctx is done,
+// fallbackGet will receive a ctx that is also bounded by Config.Timeout.
+func (c *Cluster) GetOrSetContext(ctx context.Context, key []byte, fallbackGet proto.FallbackGetContextFunc) (val []byte, err error) {
+	ctx, deadline, cancel := c.withDeadline(ctx)
+	defer cancel()
+
+	return c.getOrSet(ctx, deadline, key, fallbackWithContext(ctx, fallbackGet))
+}
 
-	err = c.do(deadline, key, func(m member, threadID uint64) error {
-		val, err = m.GetOrSet(deadline, threadID, key, fallbackGet)
+func (c *Cluster) getOrSet(ctx context.Context, deadline time.Time, key []byte, fallbackGet proto.FallbackGetFunc) ([]byte, error) {
+	return c.front.getOrSet(ctx, key, fallbackGet, func(fallbackGet proto.FallbackGetFunc) ([]byte, error) {
+		return c.__getOrSet(ctx, deadline, key, fallbackGet)
+	})
+}
+
+// GetOrSetAppend is like GetOrSet, but appends the value to dst, dst is
+// returned on error. It saves the copy of the value only,
+// unlike Client.GetOrSetAppend a hit allocates, for the permission of the
+// cluster authority and the retry.
+func (c *Cluster) GetOrSetAppend(dst, key []byte, get proto.FallbackGetFunc) ([]byte, error) {
+	ctx, deadline, cancel := c.withDeadline(context.Background())
+	defer cancel()
+
+	if !c.front.bypassed() {
+		val, err := c.getOrSet(ctx, deadline, key, get)
+		if err != nil && val == nil {
+			return dst, err
+		}
+		return append(dst, val...), err
+	}
+
+	val := dst
+	err := c.degraded.flush(ctx, key)
+	if err == nil {
+		err = c.doKey(ctx, deadline, key, func(m *member, threadID uint64) (err error) {
+			val, err = m.GetOrSetAppend(ctx, deadline, threadID, dst, key, get)
+			return err
+		})
+	}
+	if err != nil {
+		if c.failOpen(err) {
+			val, err = uncachedGet(key, get, err)
+		} else {
+			val, err = c.degraded.getOrSet(key, get, err)
+		}
+		if val != nil {
+			val = append(dst, val...)
+		}
+	}
+	if errors.Is(err, errUncached) {
+		err = nil
+	}
+	if err != nil && val == nil {
+		return dst, err
+	}
+	return val, err
+}
+
+func (c *Cluster) __getOrSet(ctx context.Context, deadline time.Time, key []byte, fallbackGet proto.FallbackGetFunc) (val []byte, err error) {
+	if err = c.degraded.flush(ctx, key); err != nil {
+		return c.degraded.getOrSet(key, fallbackGet, err)
+	}
+
+	err = c.doKey(ctx, deadline, key, func(m *member, threadID uint64) error {
+		val, err = m.GetOrSet(ctx, deadline, threadID, key, fallbackGet)
 		return err
 	})
+	if c.failOpen(err) {
+		return uncachedGet(key, fallbackGet, err)
+	}
+	if err != nil {
+		return c.degraded.getOrSet(key, fallbackGet, err)
+	}
 	return
 }
 
+// GetOrSetStream is like Client.GetOrSetStream. The value of a miss is set
+// while it is read, after the cluster version is approved, so the version is
+// approved again once the value is set, and the value is deleted if the
+// version changed.
+//
+// Note: the Observer, the near cache and the degraded mode are bypassed.
+func (c *Cluster) GetOrSetStream(ctx context.Context, key []byte, get StreamFallbackGetFunc) (io.ReadCloser, int64, error) {
+	deadline := c.deadline()
+	requestCtx, cancel := context.WithDeadlineCause(ctx, deadline, errTimeout)
+	defer cancel()
+
+	var s *stream
+	err := c.doKey(requestCtx, deadline, key, func(m *member, threadID uint64) error {
+		// the stream of the attempt under an old cluster version
+		if s != nil {
+			s.Close()
+			s = nil
+		}
+
+		var err error
+		s, err = m.GetOrSetStream(ctx, deadline, c.config.Timeout, threadID, key, get)
+		return err
+	})
+	if c.failOpen(err) {
+		return directStreamFallbackGet(ctx, key, get)
+	}
+	if err != nil {
+		if s != nil {
+			s.Close()
+		}
+		return nil, 0, err
+	}
+
+	// a rebuild since the approval only makes the value deleted
+	c.mu.RLock()
+	version := c.version
+	c.mu.RUnlock()
+	s.approved = func() bool {
+		return c.approved(version)
+	}
+	return s, s.left, nil
+}
+
+// approved reports whether the cluster is still of version, by a permission
+// request like doOnce.
+func (c *Cluster) approved(version uint64) bool {
+	ctx, deadline, cancel := c.withDeadline(context.Background())
+	defer cancel()
+
+	v, auth, _, err := c.auth()
+	if err != nil || v != version {
+		return false
+	}
+
+	ch, err := auth.RequestPermission(deadline)
+	if err != nil {
+		return false
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case v := <-ch:
+		return v == version
+	}
+}
+
+// MultiGetOrSet shares a single cluster authority permission for all keys,
+// get is called once with all keys missed in an attempt, a retry runs the
+// keys failed only, or all keys if the cluster version changed.
+func (c *Cluster) MultiGetOrSet(keys [][]byte, get BatchFallbackGetFunc) []Result {
+	ctx, deadline, cancel := c.withDeadline(context.Background())
+	defer cancel()
+
+	return c.multiGetOrSet(ctx, deadline, keys, get)
+}
+
+func (c *Cluster) MultiGetOrSetContext(ctx context.Context, keys [][]byte, get BatchFallbackGetContextFunc) []Result {
+	ctx, deadline, cancel := c.withDeadline(ctx)
+	defer cancel()
+
+	return c.multiGetOrSet(ctx, deadline, keys, batchFallbackWithContext(ctx, get))
+}
+
+func (c *Cluster) multiGetOrSet(ctx context.Context, deadline time.Time, keys [][]byte, get BatchFallbackGetFunc) []Result {
+	return c.front.multiGetOrSet(keys, get, func(b *batch, get BatchFallbackGetFunc) {
+		var pending []int
+		for _, i := range b.unique {
+			if err := c.degraded.flush(ctx, keys[i]); err != nil {
+				b.results[i] = Result{Err: err}
+				continue
+			}
+			pending = append(pending, i)
+		}
+		all := pending
+		var version uint64
+		err := c.do(ctx, deadline, func(v uint64, members []member) error {
+			// the keys succeeded in a failed attempt are not approved, they
+			// are run again under another version
+			if v != version {
+				pending = all
+			}
+			version = v
+
+			allowed := make(map[*member]bool)
+			trials := make(map[*member]bool)
+			groups := make(map[*thread][]batchKey)
+			for _, i := range pending {
+				m, threadID := c.route(members, keys[i])
+				ok, seen := allowed[m]
+				if !seen {
+					ok, trials[m] = m.breaker.allow()
+					allowed[m] = ok
+				}
+				if !ok {
+					b.results[i] = Result{Err: fmt.Errorf("%w: %s", ErrCircuitOpen, m.address)}
+					continue
+				}
+
+				t := &m.threads[threadID]
+				groups[t] = append(groups[t], batchKey{m.realKey(keys[i]), i})
+			}
+
+			b.run(ctx, deadline, groups, get)
+
+			// a member fails if any of its keys fails, the breaker tells
+			// whether the failure is caused by the member
+			errs := make(map[*member]error)
+			for _, i := range pending {
+				m, _ := c.route(members, keys[i])
+				if err := b.results[i].Err; allowed[m] && err != nil && !errors.Is(err, proto.ErrClientSide) && errs[m] == nil {
+					errs[m] = err
+				}
+			}
+			for m, ok := range allowed {
+				if ok {
+					m.breaker.done(ctx, errs[m], trials[m])
+				}
+			}
+			err := b.retryErr(pending, c.config.Retry.retryable)
+			if err != nil {
+				pending = b.failed(pending)
+			} else {
+				// all keys are run again if the version changes after f
+				pending = all
+			}
+			return err
+		})
+		if err != nil {
+			b.fail(err)
+		}
+		if c.config.Breaker.FailOpen {
+			b.fallback(func(err error) bool {
+				return errors.Is(err, ErrCircuitOpen)
+			}, get)
+		}
+		c.degraded.multiGetOrSet(b, get)
+	})
+}
+
+func (c *Cluster) NearCacheStats() NearCacheStats {
+	return c.near.Stats()
+}
+
 func (c *Cluster) __close() {
 	c.authority.Close()
 	for _, m := range c.members {
@@ -218,6 +600,10 @@ func (c *Cluster) __close() {
 }
 
 func (c *Cluster) Close() {
+	// the replay and the refresher take c.mu
+	c.degraded.Close()
+	c.refresher.Stop()
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
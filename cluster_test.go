@@ -4,14 +4,25 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"math"
+	"math/rand/v2"
 	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/imchuncai/umem-cache-client-Go/proto"
+	"github.com/imchuncai/umem-cache-client-Go/umemtest"
 )
 
 const (
@@ -82,6 +93,14 @@ func TestCluster(t *testing.T) {
 	t.Run("Shrink", testClusterShrink(param))
 	t.Run("Grow", testClusterGrow(param))
 	t.Run("Election", testClusterElection(param))
+	t.Run("Logger", testClusterLogger(param))
+	t.Run("IPv4", testClusterIPv4(param))
+	t.Run("Watch", testClusterWatch(param))
+	t.Run("WatchBlocked", testClusterWatchBlocked(param))
+	t.Run("StatsRebuild", testClusterStatsRebuild(param))
+	t.Run("Refresh", testClusterRefresh(param))
+	t.Run("RefreshAvailable", testClusterRefreshAvailable(param))
+	t.Run("TypeChange", testClusterTypeChange(param))
 }
 
 func testClusterBasic(t *testing.T, param TestParam) {
@@ -99,6 +118,12 @@ func testClusterBasic(t *testing.T, param TestParam) {
 
 	pool := NewPool(CLUSTER_KEY_SIZE_LIMIT, CLUSTER_FUZZ_N)
 	testBasic(t, cluster, pool)
+	t.Run("Stream", testStream(cluster))
+	t.Run("StreamVersionChanged", testClusterStreamVersionChanged(cluster))
+	t.Run("Breaker", testClusterBreaker(param))
+	t.Run("Degraded", testClusterDegraded(param))
+	t.Run("MultiGetOrSetRetry", testClusterMultiGetOrSetRetry(param))
+	t.Run("RebuildUnchanged", testClusterRebuildUnchanged(param))
 
 	t.Run("NotAdmin", testClusterNotAdmin(param))
 	t.Run("AdjustDuplicate", testClusterAdjustDuplicate(param))
@@ -368,3 +393,887 @@ func testClusterElection(param TestParam) func(t *testing.T) {
 		}
 	}
 }
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func testClusterLogger(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		from := ADDRESSES_ADMIN4()
+		to := ADDRESSES_ADMIN4()
+		to[0] = ADDRESSES_ADMIN8()[4]
+
+		machines, err := RunAndInitCluster(param, 8, from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer machines.Stop()
+
+		var logs syncBuffer
+		config := param.Config
+		config.Logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		cluster, err := NewCluster(ADDRESSES4(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cluster.Close()
+
+		deadline := DEADLINE()
+		version := cluster.Stats().Version
+		err = AdminChangeCluster(deadline, from, to, param.Config.TLSConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := Case{[]byte("key"), []byte("val")}
+		for cluster.Stats().Version == version {
+			if time.Now().After(deadline) {
+				t.Fatalf("cluster is not rebuilt, logs:\n%s", logs.String())
+			}
+			cluster.GetOrSet(c.Key, fallbackGet(c))
+		}
+
+		text := logs.String()
+		expects := []string{
+			"msg=\"cluster leader changed\"",
+			"msg=\"cluster version changed\"",
+			"msg=\"member rebuilt\"",
+			"old_version=" + fmt.Sprint(version),
+		}
+		for _, expect := range expects {
+			if !strings.Contains(text, expect) {
+				t.Errorf("missing %q in logs:\n%s", expect, text)
+			}
+		}
+	}
+}
+
+func testClusterIPv4(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		if !param.Hermetic() {
+			t.Skip("umem-cache machines listen on IPv6")
+		}
+
+		var admins, seeds []string
+		for range 4 {
+			server, err := umemtest.NewServer("127.0.0.1:0", umemtest.Config{
+				AdminAddress: "127.0.0.1:0",
+				ThreadNR:     THREAD_NR,
+				Timeout:      TCP_TIMEOUT,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer server.Close()
+
+			admins = append(admins, server.AdminAddr())
+			_, port, _ := net.SplitHostPort(server.Addr())
+			seeds = append(seeds, net.JoinHostPort("localhost", port))
+		}
+
+		err := AdminInitCluster(DEADLINE(), admins, param.Config.TLSConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cluster, err := NewCluster(seeds, param.Config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cluster.Close()
+
+		stats := cluster.Stats()
+		for i, m := range stats.Members {
+			if m.Address != admins[i] {
+				t.Fatalf("want member address: %s, got: %s", admins[i], m.Address)
+			}
+		}
+		if stats.Leader != admins[0] {
+			t.Fatalf("want leader: %s, got: %s", admins[0], stats.Leader)
+		}
+
+		c := Case{[]byte("ipv4"), []byte("val")}
+		set(t, cluster, c)
+		check(t, cluster, c)
+	}
+}
+
+func testClusterBreaker(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		const openTimeout = time.Second
+
+		var blocked, slow atomic.Value
+		blocked.Store("")
+		slow.Store("")
+		config := param.Config
+		config.Breaker = BreakerConfig{Failures: 1, OpenTimeout: openTimeout}
+		config.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			if address == blocked.Load() {
+				return nil, errors.New("blocked")
+			}
+			if address == slow.Load() {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		}
+		cluster, err := NewCluster(ADDRESSES4(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cluster.Close()
+
+		// admin requests to the leader should not be blocked
+		index := 0
+		if cluster.members[index].address == cluster.leader {
+			index++
+		}
+		m := &cluster.members[index]
+		var c Case
+		for i := 0; ; i++ {
+			c = Case{[]byte(fmt.Sprint("breaker", i)), []byte("val")}
+			if routed, _ := cluster.route(cluster.members, c.Key); routed == m {
+				break
+			}
+		}
+
+		// the deadline of the caller is not a failure of the member
+		slow.Store(m.threads[0].route)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err = cluster.GetOrSetContext(ctx, c.Key, nil)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("want error: %v, got: %v", context.DeadlineExceeded, err)
+		}
+		if stats := cluster.Stats().Members[index].Breaker; stats.State != BreakerClosed {
+			t.Fatalf("bad breaker stats: %+v", stats)
+		}
+		slow.Store("")
+
+		blocked.Store(m.threads[0].route)
+		_, err = cluster.GetOrSet(c.Key, fallbackGet(c))
+		if !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("want error: %v, got: %v", ErrCircuitOpen, err)
+		}
+		if stats := cluster.Stats().Members[index].Breaker; stats.State != BreakerOpen || stats.Opens != 1 {
+			t.Fatalf("bad breaker stats: %+v", stats)
+		}
+
+		// fail fast
+		start := time.Now()
+		_, err = cluster.GetOrSet(c.Key, fallbackGet(c))
+		if !errors.Is(err, ErrCircuitOpen) || time.Since(start) > openTimeout/2 {
+			t.Fatalf("want fail fast, got: %v after %v", err, time.Since(start))
+		}
+
+		// the values got by FailOpen are not kept in the near cache
+		config.Breaker.FailOpen = true
+		config.NearCacheSize = 1 << 20
+		config.NearCacheTTL = time.Minute
+		failOpen, err := NewCluster(ADDRESSES4(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer failOpen.Close()
+
+		check(t, failOpen, c)
+		results := failOpen.MultiGetOrSet([][]byte{c.Key}, func(keys [][]byte) ([][]byte, error) {
+			return [][]byte{c.Val}, nil
+		})
+		if results[0].Err != nil || !results[0].Uncached || string(results[0].Val) != string(c.Val) {
+			t.Fatalf("bad fail-open result: %+v", results[0])
+		}
+		if stats := failOpen.NearCacheStats(); stats.Entries != 0 {
+			t.Fatalf("want no near cache entry, got: %+v", stats)
+		}
+
+		blocked.Store("")
+		time.Sleep(openTimeout)
+		set(t, cluster, c)
+		if stats := cluster.Stats().Members[index].Breaker; stats.State != BreakerClosed {
+			t.Fatalf("bad breaker stats: %+v", stats)
+		}
+	}
+}
+
+func testClusterDegraded(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		var blocked, slow atomic.Value
+		blocked.Store("")
+		slow.Store("")
+		config := param.Config
+		config.Timeout = time.Second
+		config.Retry = RetryPolicy{MaxAttempts: 1}
+		config.Degraded = DegradedConfig{Enabled: true, ReplayInterval: 10 * time.Millisecond}
+		config.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			if address == blocked.Load() {
+				return nil, errors.New("blocked")
+			}
+			if address == slow.Load() {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		}
+		cluster, err := NewCluster(ADDRESSES4(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cluster.Close()
+
+		// admin requests to the leader should not be blocked
+		index := 0
+		if cluster.members[index].address == cluster.leader {
+			index++
+		}
+		m := &cluster.members[index]
+		var c Case
+		for i := 0; ; i++ {
+			c = Case{[]byte(fmt.Sprint("degraded", i)), []byte("val")}
+			if routed, _ := cluster.route(cluster.members, c.Key); routed == m {
+				break
+			}
+		}
+		// the connections of cluster are never dialed to m
+		other, err := NewCluster(ADDRESSES4(), param.Config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer other.Close()
+		set(t, other, c)
+		blocked.Store(m.threads[0].route)
+
+		fresh := Case{c.Key, []byte("fresh")}
+		val, err := cluster.GetOrSet(c.Key, fallbackGet(fresh))
+		if err != nil || string(val) != string(fresh.Val) {
+			t.Fatalf("want value: %s, got: %s %v", fresh.Val, val, err)
+		}
+		val, err = cluster.GetOrSetAppend([]byte("a"), c.Key, fallbackGet(fresh))
+		if err != nil || string(val) != "a"+string(fresh.Val) {
+			t.Fatalf("want appended value, got: %s %v", val, err)
+		}
+		results := cluster.MultiGetOrSet([][]byte{c.Key}, func(keys [][]byte) ([][]byte, error) {
+			return [][]byte{fresh.Val}, nil
+		})
+		if results[0].Err != nil || !results[0].Uncached || string(results[0].Val) != string(fresh.Val) {
+			t.Fatalf("bad degraded result: %+v", results[0])
+		}
+
+		observer := &recordObserver{}
+		cluster.front.observer = observer
+		val, err = cluster.GetOrSet(c.Key, fallbackGet(fresh))
+		if err != nil || string(val) != string(fresh.Val) {
+			t.Fatalf("want value: %s, got: %s %v", fresh.Val, val, err)
+		}
+		if e := observer.operations[0]; !e.Uncached || e.Hit || e.Err != nil {
+			t.Fatalf("bad degraded event: %+v", e)
+		}
+		cluster.front.observer = nil
+
+		err = cluster.Del(c.Key)
+		if !errors.Is(err, ErrDelQueued) {
+			t.Fatalf("want error: %v, got: %v", ErrDelQueued, err)
+		}
+		if queued := cluster.Stats().QueuedDels; queued != 1 {
+			t.Fatalf("want queued dels: 1, got: %d", queued)
+		}
+
+		// the read does not wait for the replay on a member known down
+		deadline := DEADLINE()
+		for !m.replayFailed.Load() {
+			if time.Now().After(deadline) {
+				t.Fatal("replay of the queued del does not fail")
+			}
+			nap()
+		}
+		slow.Store(m.threads[0].route)
+		blocked.Store("")
+		start := time.Now()
+		val, err = cluster.GetOrSet(c.Key, fallbackGet(fresh))
+		if err != nil || string(val) != string(fresh.Val) {
+			t.Fatalf("want value: %s, got: %s %v", fresh.Val, val, err)
+		}
+		if elapsed := time.Since(start); elapsed > config.Timeout/2 {
+			t.Fatalf("read waited for the replay: %v", elapsed)
+		}
+
+		slow.Store("")
+		deadline = DEADLINE()
+		for cluster.Stats().QueuedDels > 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("queued del is not replayed")
+			}
+			nap()
+		}
+		check(t, other, fresh)
+	}
+}
+
+func testClusterWatch(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		from := ADDRESSES_ADMIN4()
+		to := ADDRESSES_ADMIN4()
+		to[3] = ADDRESSES_ADMIN8()[4]
+		machines, err := RunAndInitCluster(param, 8, from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer machines.Stop()
+
+		cluster, err := NewCluster(ADDRESSES4(), param.Config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cluster.Close()
+
+		events := make(chan TopologyEvent, 16)
+		stop := cluster.Watch(func(e TopologyEvent) {
+			events <- e
+		})
+		defer stop()
+		oldVersion, oldLeader := cluster.version, cluster.leader
+
+		deadline := DEADLINE()
+		err = AdminChangeCluster(deadline, from, to, param.Config.TLSConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = AdminClusterMatch(deadline, to, param.Config.TLSConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, want, err := AdminLeaderCluster(deadline, to, param.Config.TLSConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the change is observed by operations
+		c := Case{[]byte("watch"), []byte("val")}
+		var e TopologyEvent
+		for e.New.Version != want.Version {
+			select {
+			case e = <-events:
+				if e.Old.Version != oldVersion || e.OldLeader != oldLeader {
+					t.Fatalf("want old version: %d leader: %s, got: %+v", oldVersion, oldLeader, e)
+				}
+				oldVersion, oldLeader = e.New.Version, e.NewLeader
+			default:
+				set(t, cluster, c)
+				nap()
+			}
+		}
+		if !machinesEqual(e.New.Machines, want.Machines) || e.New.Type != want.Type {
+			t.Fatalf("want cluster: %+v, got: %+v", want, e.New)
+		}
+		if e.NewLeader != cluster.Stats().Leader {
+			t.Fatalf("want leader: %s, got: %s", cluster.Stats().Leader, e.NewLeader)
+		}
+	}
+}
+
+func testClusterWatchBlocked(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		from := ADDRESSES_ADMIN4()
+		to := ADDRESSES_ADMIN4()
+		to[3] = ADDRESSES_ADMIN8()[4]
+		machines, err := RunAndInitCluster(param, 8, from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer machines.Stop()
+
+		cluster, err := NewCluster(ADDRESSES4(), param.Config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cluster.Close()
+
+		called := make(chan struct{}, 1)
+		block := make(chan struct{})
+		defer close(block)
+		stop := cluster.Watch(func(e TopologyEvent) {
+			select {
+			case called <- struct{}{}:
+			default:
+			}
+			<-block
+		})
+		defer stop()
+
+		deadline := DEADLINE()
+		err = AdminChangeCluster(deadline, from, to, param.Config.TLSConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = AdminClusterMatch(deadline, to, param.Config.TLSConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, want, err := AdminLeaderCluster(deadline, to, param.Config.TLSConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the blocked watcher does not stall the rebuilds
+		c := Case{[]byte("watch blocked"), []byte("val")}
+		for cluster.Stats().Version != want.Version {
+			if time.Now().After(deadline) {
+				t.Fatalf("want version: %d, got: %d", want.Version, cluster.Stats().Version)
+			}
+			cluster.GetOrSet(c.Key, fallbackGet(c))
+			nap()
+		}
+		select {
+		case <-called:
+		case <-time.After(time.Until(deadline)):
+			t.Fatal("watcher is not called")
+		}
+		set(t, cluster, c)
+		check(t, cluster, c)
+	}
+}
+
+func testClusterRefresh(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		from := ADDRESSES_ADMIN4()
+		to := ADDRESSES_ADMIN4()
+		to[0] = ADDRESSES_ADMIN8()[4]
+		machines, err := RunAndInitCluster(param, 8, from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer machines.Stop()
+
+		config := param.Config
+		config.RefreshInterval = 10 * time.Millisecond
+		cluster, err := NewCluster(ADDRESSES4(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cluster.Close()
+
+		deadline := DEADLINE()
+		err = AdminChangeCluster(deadline, from, to, param.Config.TLSConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = AdminClusterMatch(deadline, to, param.Config.TLSConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leader, want, err := AdminLeaderCluster(deadline, to, param.Config.TLSConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the change is observed without operations
+		for {
+			stats := cluster.Stats()
+			if stats.Version == want.Version && stats.Leader == leader {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("want version: %d leader: %s, got: %d %s", want.Version, leader, stats.Version, stats.Leader)
+			}
+			nap()
+		}
+		c := Case{[]byte("refresh"), []byte("val")}
+		set(t, cluster, c)
+		check(t, cluster, c)
+	}
+}
+
+func testClusterRefreshAvailable(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		machines, err := RunAndInitCluster(param, 4, ADDRESSES_ADMIN4())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer machines.Stop()
+
+		observer := &recordObserver{}
+		config := param.Config
+		config.Observer = observer
+		config.RefreshInterval = 10 * time.Millisecond
+		cluster, err := NewCluster(ADDRESSES4(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cluster.Close()
+
+		events := make(chan TopologyEvent, 16)
+		stop := cluster.Watch(func(e TopologyEvent) {
+			events <- e
+		})
+		defer stop()
+
+		c := Case{[]byte("refresh available"), []byte("val")}
+		set(t, cluster, c)
+
+		var wg sync.WaitGroup
+		done := make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				val, err := cluster.GetOrSet(c.Key, fallbackGet(c))
+				if err != nil || string(val) != string(c.Val) {
+					t.Errorf("want value: %s, got: %s %v", c.Val, val, err)
+					return
+				}
+			}
+		}()
+		defer func() {
+			close(done)
+			wg.Wait()
+		}()
+
+		// the availability of a machine differs from the cluster only
+		cluster.mu.Lock()
+		version := cluster.version
+		want := cluster.machines
+		stale := slices.Clone(want)
+		stale[3].Stability++
+		cluster.machines = stale
+		cluster.mu.Unlock()
+
+		select {
+		case e := <-events:
+			if e.New.Version != version || e.NewLeader != e.OldLeader ||
+				!machinesEqual(e.Old.Machines, stale) || !machinesEqual(e.New.Machines, want) {
+				t.Fatalf("want availability changed only, got: %+v", e)
+			}
+		case <-time.After(time.Until(DEADLINE())):
+			t.Fatal("availability change is not observed")
+		}
+
+		observer.mu.Lock()
+		rebuilds := observer.rebuilds
+		observer.mu.Unlock()
+		if rebuilds != 0 {
+			t.Fatalf("want no rebuild, got: %d", rebuilds)
+		}
+		if stats := cluster.Stats(); stats.Version != version {
+			t.Fatalf("want version: %d, got: %d", version, stats.Version)
+		}
+	}
+}
+
+func testClusterTypeChange(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		machines, err := RunAndInitCluster(param, 4, ADDRESSES_ADMIN4())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer machines.Stop()
+		if machines[0].server == nil {
+			t.Skip("the type is set by umemtest only")
+		}
+
+		observer := &recordObserver{}
+		config := param.Config
+		config.Observer = observer
+		cluster, err := NewCluster(ADDRESSES4(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cluster.Close()
+
+		events := make(chan TopologyEvent, 16)
+		stop := cluster.Watch(func(e TopologyEvent) {
+			events <- e
+		})
+		defer stop()
+
+		wait := func(want proto.ClusterType) {
+			t.Helper()
+
+			select {
+			case e := <-events:
+				if e.New.Type != want || e.New.Version != e.Old.Version {
+					t.Fatalf("want type: %s changed only, got: %+v", want, e)
+				}
+			case <-time.After(time.Until(DEADLINE())):
+				t.Fatal("type change is not observed")
+			}
+			if got := cluster.Stats().Type; got != want {
+				t.Fatalf("want type: %s, got: %s", want, got)
+			}
+		}
+
+		// the type is changed once by rebuilds of the same version
+		machines[0].server.SetClusterType(1)
+		for range 2 {
+			cluster.rebuild(cluster.Stats().Version)
+			for updating(cluster) {
+				nap()
+			}
+		}
+		wait(1)
+		select {
+		case e := <-events:
+			t.Fatalf("want no event, got: %+v", e)
+		default:
+		}
+
+		// the type is changed by a refresh without a rebuild
+		machines[0].server.SetClusterType(0)
+		rebuilds := observer.rebuilds
+		err = cluster.refresh()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wait(0)
+		if observer.rebuilds != rebuilds {
+			t.Fatalf("want no rebuild, got: %d", observer.rebuilds-rebuilds)
+		}
+	}
+}
+
+func testClusterMultiGetOrSetRetry(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		other, err := NewCluster(ADDRESSES4(), param.Config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer other.Close()
+
+		var keys [][]byte
+		var blocked atomic.Value
+		blocked.Store("")
+		config := param.Config
+		// the key resolved would miss again if it is run again
+		config.Observer = retryObserver{onRetry: func(attempt int, err error) {
+			del(t, other, Case{keys[1], nil})
+		}}
+		config.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			// only the first dial is blocked
+			if blocked.CompareAndSwap(address, "") {
+				return nil, errors.New("blocked")
+			}
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		}
+		cluster, err := NewCluster(ADDRESSES4(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cluster.Close()
+
+		// a key on the blocked member, and a key on another member, no
+		// connection is dialed before
+		keys = make([][]byte, 2)
+		for keys[0] == nil || keys[1] == nil {
+			key := []byte(fmt.Sprint("multi-retry", rand.Uint64()))
+			m, _ := cluster.route(cluster.members, key)
+			if m == &cluster.members[0] {
+				keys[0] = key
+			} else {
+				keys[1] = key
+			}
+		}
+		blocked.Store(cluster.members[0].threads[0].route)
+
+		var mu sync.Mutex
+		calls := make(map[string]int)
+		results := cluster.MultiGetOrSet(keys, func(keys [][]byte) ([][]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			for _, key := range keys {
+				calls[string(key)]++
+			}
+			return keys, nil
+		})
+		for i, r := range results {
+			if r.Err != nil || string(r.Val) != string(keys[i]) {
+				t.Fatalf("bad result: %+v", r)
+			}
+			if calls[string(keys[i])] != 1 {
+				t.Fatalf("want 1 fallback call of: %s, got: %d", keys[i], calls[string(keys[i])])
+			}
+		}
+	}
+}
+
+type retryObserver struct {
+	NopObserver
+	onRetry func(attempt int, err error)
+}
+
+func (o retryObserver) OnRetry(attempt int, err error) {
+	o.onRetry(attempt, err)
+}
+
+// dials returns dials of members by address.
+func dials(stats Stats) map[string]uint64 {
+	dials := make(map[string]uint64)
+	for _, m := range stats.Members {
+		for _, t := range m.Threads {
+			dials[m.Address] += t.Dials
+		}
+	}
+	return dials
+}
+
+func testClusterStatsRebuild(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		from := ADDRESSES_ADMIN4()
+		to := ADDRESSES_ADMIN4()
+		to[3] = ADDRESSES_ADMIN8()[4]
+		machines, err := RunAndInitCluster(param, 8, from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer machines.Stop()
+
+		cluster, err := NewCluster(ADDRESSES4(), param.Config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cluster.Close()
+
+		// dial threads of all members
+		keys := make([][]byte, 64)
+		for i := range keys {
+			keys[i] = fmt.Appendf(nil, "stats-%d", i)
+		}
+		for _, r := range cluster.MultiGetOrSet(keys, func(keys [][]byte) ([][]byte, error) {
+			return keys, nil
+		}) {
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+		}
+		before := dials(cluster.Stats())
+
+		deadline := DEADLINE()
+		err = AdminChangeCluster(deadline, from, to, param.Config.TLSConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = AdminClusterMatch(deadline, to, param.Config.TLSConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, want, err := AdminLeaderCluster(deadline, to, param.Config.TLSConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := Case{[]byte("stats"), []byte("val")}
+		for cluster.Stats().Version != want.Version {
+			if time.Now().After(deadline) {
+				t.Fatal("cluster is not rebuilt")
+			}
+			set(t, cluster, c)
+			nap()
+		}
+
+		after := dials(cluster.Stats())
+		var kept int
+		for address, n := range after {
+			if m, ok := before[address]; ok {
+				kept++
+				if n < m {
+					t.Fatalf("dials of member: %s reset from %d to %d", address, m, n)
+				}
+			}
+		}
+		if kept == 0 {
+			t.Fatalf("no member kept, before: %v, after: %v", before, after)
+		}
+	}
+}
+
+// testClusterStreamVersionChanged sets a value by a stream, while the
+// cluster version changes before it is read out.
+func testClusterStreamVersionChanged(cluster *Cluster) func(t *testing.T) {
+	return func(t *testing.T) {
+		tc := Case{[]byte("stream-version"), []byte("world")}
+		del(t, cluster, tc)
+
+		r, _, err := cluster.GetOrSetStream(context.Background(), tc.Key, func(ctx context.Context, key []byte) (io.Reader, int64, error) {
+			return bytes.NewReader(tc.Val), int64(len(tc.Val)), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := r.(*stream)
+		cluster.mu.RLock()
+		version := cluster.version
+		cluster.mu.RUnlock()
+		s.approved = func() bool {
+			return cluster.approved(version + 1)
+		}
+
+		val, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(val, tc.Val) {
+			t.Fatalf("want: %v, got: %q, error: %v", tc, val, err)
+		}
+		badGetOrSet(t, cluster, tc)
+
+		if !cluster.approved(version) {
+			t.Fatal("want version approved")
+		}
+	}
+}
+
+func testClusterRebuildUnchanged(param TestParam) func(t *testing.T) {
+	return func(t *testing.T) {
+		observer := &recordObserver{}
+		config := param.Config
+		config.Observer = observer
+		cluster, err := NewCluster(ADDRESSES4(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cluster.Close()
+
+		cluster.mu.RLock()
+		version := cluster.version
+		cluster.mu.RUnlock()
+		cluster.rebuild(version)
+		for updating(cluster) {
+			nap()
+		}
+
+		observer.mu.Lock()
+		defer observer.mu.Unlock()
+
+		if observer.rebuilds != 0 {
+			t.Fatalf("want no rebuild reported, got: %d", observer.rebuilds)
+		}
+	}
+}
+
+func updating(c *Cluster) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.updating
+}
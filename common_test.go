@@ -14,12 +14,15 @@ import (
 	"net"
 	"os"
 	"os/exec"
+	"slices"
 	"strconv"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
 
 	"github.com/imchuncai/umem-cache-client-Go/proto"
+	"github.com/imchuncai/umem-cache-client-Go/umemtest"
 )
 
 const (
@@ -29,6 +32,7 @@ const (
 	SERVER_MEMORY   = 100 << 20
 	TIMEOUT         = 10 * time.Second
 	THREAD_MAX_CONN = 512 / THREAD_NR
+	TCP_TIMEOUT     = 1 * time.Second
 )
 
 func ErrIsClosedByPeer(err error) bool {
@@ -41,43 +45,74 @@ func DEADLINE() time.Time {
 	return time.Now().Add(TIMEOUT)
 }
 
+// TestParam with empty ExePath runs machines in process by umemtest.
 type TestParam struct {
-	ExePath string
-	Config  Config
-	Debug   bool
+	ExePath         string
+	Config          Config
+	ServerTLSConfig *tls.Config
+	Debug           bool
 }
 
-func InitTest(t *testing.T) TestParam {
+func (param TestParam) Hermetic() bool {
+	return param.ExePath == ""
+}
+
+func InitTest(t testing.TB) TestParam {
+	var param TestParam
+	param.Config.Timeout = TIMEOUT
+	param.Config.ThreadNR = THREAD_NR
+
 	args := flag.Args()
+	if len(args) == 0 {
+		return param
+	}
 	if len(args) < 3 {
 		t.Fatal("bad args")
 	}
 
-	var param TestParam
 	param.ExePath = args[0]
 	param.Debug = args[2] != "0"
-	param.Config.Timeout = TIMEOUT
-	param.Config.ThreadNR = THREAD_NR
 	_tls := args[1] != "0"
 	if _tls {
-		cert, err := tls.LoadX509KeyPair("cert.pem", "key.pem")
+		var err error
+		param.Config.TLSConfig, param.ServerTLSConfig, err = LoadTLSConfig()
 		if err != nil {
 			t.Fatal(err)
 		}
+	}
+	return param
+}
 
-		caCert, err := os.ReadFile("ca-cert.pem")
-		if err != nil {
-			t.Fatal(err)
-		}
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
+func LoadTLSConfig() (client *tls.Config, server *tls.Config, err error) {
+	cert, err := tls.LoadX509KeyPair("cert.pem", "key.pem")
+	if err != nil {
+		return nil, nil, err
+	}
 
-		param.Config.TLSConfig = &tls.Config{
-			Certificates: []tls.Certificate{cert},
-			RootCAs:      caCertPool,
-		}
+	caCert, err := os.ReadFile("ca-cert.pem")
+	if err != nil {
+		return nil, nil, err
+	}
+	caCertPool := x509.NewCertPool()
+	caCertPool.AppendCertsFromPEM(caCert)
+
+	client = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      caCertPool,
+	}
+	server = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    caCertPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	return client, server, nil
+}
+
+// SkipHermetic skips tests that depend on umem-cache internals.
+func SkipHermetic(t *testing.T, param TestParam) {
+	if param.Hermetic() {
+		t.Skip("requires umem-cache executable")
 	}
-	return param
 }
 
 type Case struct {
@@ -124,8 +159,9 @@ func (p *Pool) RandCase() Case {
 }
 
 type Machine struct {
-	addr string
-	cmd  *exec.Cmd
+	addr   string
+	cmd    *exec.Cmd
+	server *umemtest.Server
 }
 
 func (m *Machine) Ping(deadline time.Time, config *tls.Config) error {
@@ -142,10 +178,30 @@ func (m *Machine) Ping(deadline time.Time, config *tls.Config) error {
 	}
 }
 
+func nap() {
+	time.Sleep(100 * time.Millisecond)
+}
+
 func MachineAddress(port int) string {
 	return "[::1]:" + strconv.Itoa(port)
 }
 
+func runHermeticMachine(port int, param TestParam) (*Machine, error) {
+	address := MachineAddress(port)
+	server, err := umemtest.NewServer(address, umemtest.Config{
+		AdminAddress:      MachineAddress(port + 1),
+		ThreadNR:          THREAD_NR,
+		MaxConnsPerThread: THREAD_MAX_CONN,
+		Timeout:           TCP_TIMEOUT,
+		TLSConfig:         param.ServerTLSConfig,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("start server failed: %w", err)
+	}
+
+	return &Machine{addr: address, server: server}, nil
+}
+
 func runTestMachine(port int, param TestParam) (*Machine, error) {
 	address := MachineAddress(port)
 	_, err := net.ResolveTCPAddr("tcp6", address)
@@ -153,6 +209,10 @@ func runTestMachine(port int, param TestParam) (*Machine, error) {
 		return nil, fmt.Errorf("resolve address: %s failed: %w", address, err)
 	}
 
+	if param.Hermetic() {
+		return runHermeticMachine(port, param)
+	}
+
 	cmd := exec.Command(param.ExePath, strconv.Itoa(port), "cert.pem", "key.pem", "ca-cert.pem")
 	if param.Debug {
 		err := os.MkdirAll("logs", 0777)
@@ -174,7 +234,7 @@ func runTestMachine(port int, param TestParam) (*Machine, error) {
 		return nil, fmt.Errorf("start server failed: %w", err)
 	}
 
-	return &Machine{address, cmd}, nil
+	return &Machine{addr: address, cmd: cmd}, nil
 }
 
 func RunMachine(port int, param TestParam) (*Machine, error) {
@@ -193,6 +253,12 @@ func RunMachine(port int, param TestParam) (*Machine, error) {
 }
 
 func (m *Machine) Stop() error {
+	if m.server != nil {
+		err := m.server.Close()
+		m.server = nil
+		return err
+	}
+
 	if m.cmd == nil {
 		return nil
 	}
@@ -259,13 +325,7 @@ func (machines Machines) Stop() error {
 	return err
 }
 
-type ClientInterface interface {
-	GetOrSet(key []byte, get proto.FallbackGetFunc) (val []byte, err error)
-	Del(key []byte) error
-	Close()
-}
-
-func testBasic(t *testing.T, client ClientInterface, pool Pool) {
+func testBasic(t *testing.T, client Cache, pool Pool) {
 	t.Run("Get", testGet(client, pool))
 	t.Run("Del", testDel(client, pool))
 	t.Run("GetOrSet", testGetOrSet(client, pool))
@@ -273,6 +333,7 @@ func testBasic(t *testing.T, client ClientInterface, pool Pool) {
 	// when FallbackGet the connection will be closed
 	t.Run("BadGetOrSet", testBadGetOrSet(client, pool))
 	t.Run("ConcurrentSet", testConcurrentSet(client, pool))
+	t.Run("MultiGetOrSet", testMultiGetOrSet(client, pool))
 }
 
 func fallbackGet(tc Case) proto.FallbackGetFunc {
@@ -281,7 +342,7 @@ func fallbackGet(tc Case) proto.FallbackGetFunc {
 	}
 }
 
-func getOrSet(tb testing.TB, client ClientInterface, tc Case) []byte {
+func getOrSet(tb testing.TB, client Cache, tc Case) []byte {
 	val, err := client.GetOrSet(tc.Key, fallbackGet(tc))
 	if err != nil {
 		tb.Fatalf("got error: %v test case: %v", err, tc)
@@ -289,32 +350,43 @@ func getOrSet(tb testing.TB, client ClientInterface, tc Case) []byte {
 	return val
 }
 
-func del(tb testing.TB, client ClientInterface, tc Case) {
+func del(tb testing.TB, client Cache, tc Case) {
 	err := client.Del(tc.Key)
 	if err != nil {
 		tb.Fatalf("got error: %v, key size: %d", err, len(tc.Key))
 	}
 }
 
-func set(tb testing.TB, client ClientInterface, tc Case) {
+func set(tb testing.TB, client Cache, tc Case) {
 	del(tb, client, tc)
 	getOrSet(tb, client, tc)
 }
 
-func check(tb testing.TB, client ClientInterface, tc Case) {
+func check(tb testing.TB, client Cache, tc Case) {
 	val := getOrSet(tb, client, tc)
 	if string(val) != string(tc.Val) {
 		tb.Fatalf("want: %v, got size: %d", tc, len(val))
 	}
 }
 
+// hit checks tc is cached, without populating it.
+func hit(tb testing.TB, client Cache, tc Case) {
+	val, err := client.GetOrSet(tc.Key, badFallbackGet)
+	if err != nil {
+		tb.Fatalf("got error: %v test case: %v", err, tc)
+	}
+	if string(val) != string(tc.Val) {
+		tb.Fatalf("want: %v, got size: %d", tc, len(val))
+	}
+}
+
 var errBadFallbackGet = errors.New("bad fallback get")
 
 func badFallbackGet(key []byte) (val []byte, err error) {
 	return nil, errBadFallbackGet
 }
 
-func badGetOrSet(t *testing.T, client ClientInterface, tc Case) {
+func badGetOrSet(t *testing.T, client Cache, tc Case) {
 	_, err := client.GetOrSet(tc.Key, badFallbackGet)
 	if !errors.Is(err, errBadFallbackGet) {
 		t.Fatalf("want error: %v, got error: %v test case: %v",
@@ -341,14 +413,14 @@ func fuzz(pool Pool, f func(t *testing.T, tc Case, randV []byte)) func(t *testin
 	}
 }
 
-func testGet(client ClientInterface, pool Pool) func(t *testing.T) {
+func testGet(client Cache, pool Pool) func(t *testing.T) {
 	return fuzz(pool, func(t *testing.T, tc Case, randV []byte) {
 		set(t, client, tc)
 		check(t, client, tc)
 	})
 }
 
-func testDel(client ClientInterface, pool Pool) func(t *testing.T) {
+func testDel(client Cache, pool Pool) func(t *testing.T) {
 	return fuzz(pool, func(t *testing.T, tc Case, randV []byte) {
 		set(t, client, tc)
 		del(t, client, tc)
@@ -360,7 +432,7 @@ func testDel(client ClientInterface, pool Pool) func(t *testing.T) {
 	})
 }
 
-func testGetOrSet(client ClientInterface, pool Pool) func(t *testing.T) {
+func testGetOrSet(client Cache, pool Pool) func(t *testing.T) {
 	return fuzz(pool, func(t *testing.T, tc Case, randV []byte) {
 		set(t, client, tc)
 		tc2 := Case{tc.Key, randV}
@@ -373,7 +445,7 @@ func testGetOrSet(client ClientInterface, pool Pool) func(t *testing.T) {
 	})
 }
 
-func testBadGetOrSet(client ClientInterface, pool Pool) func(t *testing.T) {
+func testBadGetOrSet(client Cache, pool Pool) func(t *testing.T) {
 	return fuzz(pool, func(t *testing.T, tc Case, randV []byte) {
 		del(t, client, tc)
 		badGetOrSet(t, client, tc)
@@ -382,7 +454,7 @@ func testBadGetOrSet(client ClientInterface, pool Pool) func(t *testing.T) {
 	})
 }
 
-func testConcurrentSet(client ClientInterface, pool Pool) func(t *testing.T) {
+func testConcurrentSet(client Cache, pool Pool) func(t *testing.T) {
 	return fuzz(pool, func(t *testing.T, tc Case, randV []byte) {
 		del(t, client, tc)
 
@@ -400,3 +472,99 @@ func testConcurrentSet(client ClientInterface, pool Pool) func(t *testing.T) {
 		check(t, client, tc)
 	})
 }
+
+func testMultiGetOrSet(client Cache, pool Pool) func(t *testing.T) {
+	return func(t *testing.T) {
+		const n = 64
+
+		cases := make(map[string]Case, n)
+		keys := make([][]byte, 0, n+1)
+		for i := range n {
+			tc := Case{[]byte(fmt.Sprintf("multi-%d", i)), pool.randN(pool.r.IntN(1 << 10))}
+			cases[string(tc.Key)] = tc
+			keys = append(keys, tc.Key)
+			if i%2 == 0 {
+				set(t, client, tc)
+			} else {
+				del(t, client, tc)
+			}
+		}
+		keys = append(keys, keys[1])
+
+		var mu sync.Mutex
+		missedN, calls := 0, 0
+		get := func(missed [][]byte) ([][]byte, error) {
+			mu.Lock()
+			missedN += len(missed)
+			calls++
+			mu.Unlock()
+
+			vals := make([][]byte, len(missed))
+			for i, key := range missed {
+				vals[i] = cases[string(key)].Val
+			}
+			return vals, nil
+		}
+
+		badGet := func(missed [][]byte) ([][]byte, error) {
+			return nil, errBadFallbackGet
+		}
+
+		checkResults := func(keys [][]byte, results []Result) {
+			for i, r := range results {
+				tc := cases[string(keys[i])]
+				if r.Err != nil {
+					t.Fatalf("got error: %v test case: %v", r.Err, tc)
+				}
+				if string(r.Val) != string(tc.Val) {
+					t.Fatalf("want: %v, got size: %d", tc, len(r.Val))
+				}
+			}
+		}
+
+		checkResults(keys, client.MultiGetOrSet(keys, get))
+		if missedN != n/2 {
+			t.Fatalf("want %d missed keys, got: %d", n/2, missedN)
+		}
+		// the keys missed on all threads are got by a single call
+		if calls != 1 {
+			t.Fatalf("want 1 fallback call, got: %d", calls)
+		}
+		checkResults(keys, client.MultiGetOrSet(keys, badGet))
+
+		del(t, client, cases[string(keys[0])])
+		results := client.MultiGetOrSet(keys, badGet)
+		if !errors.Is(results[0].Err, errBadFallbackGet) {
+			t.Fatalf("want error: %v, got error: %v", errBadFallbackGet, results[0].Err)
+		}
+		checkResults(keys[1:], results[1:])
+
+		// batches sharing missed keys across threads do not wait on each other
+		for _, tc := range cases {
+			del(t, client, tc)
+		}
+		reversed := slices.Clone(keys)
+		slices.Reverse(reversed)
+		slow := func(missed [][]byte) ([][]byte, error) {
+			time.Sleep(10 * time.Millisecond)
+			return get(missed)
+		}
+		start := time.Now()
+		var wg sync.WaitGroup
+		all := make([][]Result, 2)
+		for i, keys := range [][][]byte{keys, reversed} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				all[i] = client.MultiGetOrSet(keys, slow)
+			}()
+		}
+		wg.Wait()
+		// or the server times out the connection holding the keys
+		if d := time.Since(start); d >= TCP_TIMEOUT {
+			t.Fatalf("batches wait on each other for: %v", d)
+		}
+		checkResults(keys, all[0])
+		checkResults(reversed, all[1])
+	}
+}
@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// A compressed value starts with compressMagic and a compress format. 0xff
+// never starts a UTF-8 text, so values written without compression, such as
+// by older clients, are almost never taken as compressed. A value that does
+// start with compressMagic is stored with compressFormatStored.
+const compressMagic = "\xffUZ"
+
+const (
+	compressFormatStored byte = iota
+	compressFormatFlate
+)
+
+// compressMaxRatio is more than the best ratio of flate, a bigger size in
+// the header is corrupt.
+const compressMaxRatio = 1 << 11
+
+type CompressConfig struct {
+	// Threshold is the least size of values to compress.
+	Threshold int
+	// Level is the flate level, 0 for flate.DefaultCompression.
+	Level int
+}
+
+type CompressStats struct {
+	// Compressed values and their sizes before and after compression.
+	Compressed      uint64
+	RawBytes        uint64
+	CompressedBytes uint64
+	// Stored values are under Threshold or not smaller after compression.
+	Stored uint64
+}
+
+// Ratio is RawBytes divided by CompressedBytes, 0 for nothing compressed.
+func (s CompressStats) Ratio() float64 {
+	if s.CompressedBytes == 0 {
+		return 0
+	}
+	return float64(s.RawBytes) / float64(s.CompressedBytes)
+}
+
+// Compressed is a Cache that compresses values no smaller than Threshold,
+// compressed and uncompressed values can coexist in the same cluster.
+type Compressed struct {
+	envelope
+	config  CompressConfig
+	writers sync.Pool
+
+	compressed      atomic.Uint64
+	rawBytes        atomic.Uint64
+	compressedBytes atomic.Uint64
+	stored          atomic.Uint64
+}
+
+func NewCompressed(cache Cache, config CompressConfig) (*Compressed, error) {
+	if config.Level == 0 {
+		config.Level = flate.DefaultCompression
+	}
+	// check the level once, so that the pool never fails
+	_, err := flate.NewWriter(io.Discard, config.Level)
+	if err != nil {
+		return nil, fmt.Errorf("bad CompressConfig: %w", err)
+	}
+
+	c := &Compressed{config: config}
+	c.envelope = envelope{cache: cache, encode: c.encode, decode: c.decode}
+	return c, nil
+}
+
+func (c *Compressed) Stats() CompressStats {
+	return CompressStats{
+		Compressed:      c.compressed.Load(),
+		RawBytes:        c.rawBytes.Load(),
+		CompressedBytes: c.compressedBytes.Load(),
+		Stored:          c.stored.Load(),
+	}
+}
+
+func (c *Compressed) store(val []byte) []byte {
+	c.stored.Add(1)
+	if !bytes.HasPrefix(val, []byte(compressMagic)) {
+		return val
+	}
+
+	data := make([]byte, 0, len(compressMagic)+1+len(val))
+	data = append(data, compressMagic...)
+	data = append(data, compressFormatStored)
+	return append(data, val...)
+}
+
+func (c *Compressed) encode(key, val []byte) ([]byte, error) {
+	if len(val) < c.config.Threshold {
+		return c.store(val), nil
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(val)/2))
+	buf.WriteString(compressMagic)
+	buf.WriteByte(compressFormatFlate)
+	buf.Write(binary.AppendUvarint(nil, uint64(len(val))))
+
+	w, _ := c.writers.Get().(*flate.Writer)
+	if w == nil {
+		w, _ = flate.NewWriter(buf, c.config.Level)
+	} else {
+		w.Reset(buf)
+	}
+	defer func() {
+		w.Reset(io.Discard)
+		c.writers.Put(w)
+	}()
+
+	_, err := w.Write(val)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("compress failed: %w", err)
+	}
+
+	if buf.Len() >= len(val) {
+		return c.store(val), nil
+	}
+	c.compressed.Add(1)
+	c.rawBytes.Add(uint64(len(val)))
+	c.compressedBytes.Add(uint64(buf.Len()))
+	return buf.Bytes(), nil
+}
+
+func (c *Compressed) decode(key, data []byte) ([]byte, error) {
+	n := len(compressMagic) + 1
+	if len(data) < n || !bytes.HasPrefix(data, []byte(compressMagic)) {
+		return data, nil
+	}
+
+	switch data[n-1] {
+	case compressFormatStored:
+		return data[n:], nil
+	case compressFormatFlate:
+	default:
+		return nil, fmt.Errorf("unknown compress format: %d", data[n-1])
+	}
+
+	size, k := binary.Uvarint(data[n:])
+	if k <= 0 || size > uint64(len(data))*compressMaxRatio {
+		return nil, errors.New("bad compressed size")
+	}
+
+	r := flate.NewReader(bytes.NewReader(data[n+k:]))
+	defer r.Close()
+
+	val := make([]byte, size)
+	_, err := io.ReadFull(r, val)
+	if err == nil {
+		var one [1]byte
+		_, err = r.Read(one[:])
+		if err == io.EOF {
+			return val, nil
+		}
+		if err == nil {
+			err = errors.New("bigger than the size")
+		}
+	}
+	return nil, fmt.Errorf("decompress failed: %w", err)
+}
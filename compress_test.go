@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+func TestCompressed(t *testing.T) {
+	memory := NewMemory(KeySizeLimit, TIMEOUT)
+	compressed, err := NewCompressed(memory, CompressConfig{Threshold: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer compressed.Close()
+
+	t.Run("Compress", testCompressedCompress(compressed, memory))
+	t.Run("Coexist", testCompressedCoexist(compressed, memory))
+	t.Run("NilFallback", testCompressedNilFallback(compressed))
+
+	pool := NewPool(KeySizeLimit, CLIENT_FUZZ_N)
+	testBasic(t, compressed, pool)
+}
+
+func testCompressedCompress(compressed *Compressed, memory *Memory) func(t *testing.T) {
+	return func(t *testing.T) {
+		tc := Case{[]byte("big"), bytes.Repeat([]byte("umem-cache "), 1000)}
+		set(t, compressed, tc)
+		hit(t, compressed, tc)
+
+		raw, err := memory.GetOrSet(tc.Key, badFallbackGet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(raw) >= len(tc.Val)/10 {
+			t.Fatalf("value is not compressed, size: %d", len(raw))
+		}
+
+		stats := compressed.Stats()
+		if stats.Compressed == 0 || stats.Ratio() < 10 {
+			t.Fatalf("bad stats: %+v", stats)
+		}
+	}
+}
+
+func testCompressedCoexist(compressed *Compressed, memory *Memory) func(t *testing.T) {
+	return func(t *testing.T) {
+		// written by a client without compression
+		legacy := Case{[]byte("legacy"), bytes.Repeat([]byte{1}, 1000)}
+		set(t, memory, legacy)
+		hit(t, compressed, legacy)
+
+		// small value looks like a compressed one
+		magic := Case{[]byte("magic"), []byte(compressMagic + "\x01")}
+		set(t, compressed, magic)
+		hit(t, compressed, magic)
+	}
+}
+
+func testCompressedNilFallback(compressed *Compressed) func(t *testing.T) {
+	return func(t *testing.T) {
+		key := []byte("nil-fallback")
+		del(t, compressed, Case{key, nil})
+
+		_, err := compressed.GetOrSet(key, nil)
+		if !errors.Is(err, proto.ErrFallbackGet) {
+			t.Fatalf("want error: %v, got: %v", proto.ErrFallbackGet, err)
+		}
+		_, err = compressed.GetOrSetContext(context.Background(), key, nil)
+		if !errors.Is(err, proto.ErrFallbackGet) {
+			t.Fatalf("want error: %v, got: %v", proto.ErrFallbackGet, err)
+		}
+		results := compressed.MultiGetOrSet([][]byte{key}, nil)
+		if !errors.Is(results[0].Err, proto.ErrFallbackGet) {
+			t.Fatalf("want error: %v, got: %v", proto.ErrFallbackGet, results[0].Err)
+		}
+		results = compressed.MultiGetOrSetContext(context.Background(), [][]byte{key}, nil)
+		if !errors.Is(results[0].Err, proto.ErrFallbackGet) {
+			t.Fatalf("want error: %v, got: %v", proto.ErrFallbackGet, results[0].Err)
+		}
+	}
+}
@@ -6,7 +6,10 @@ package client
 import (
 	"crypto/tls"
 	"fmt"
+	"log/slog"
 	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
 )
 
 type Config struct {
@@ -14,6 +17,41 @@ type Config struct {
 	ThreadNR          int
 	MaxConnsPerThread int
 	TLSConfig         *tls.Config
+	// DialContext dials connections that TLS is layered on, nil for dialing
+	// "tcp" by a net.Dialer.
+	DialContext proto.DialFunc
+	// Coalesce concurrent GetOrSet of the same key in process, only one of
+	// them talks to umem-cache, and others share its result.
+	Coalesce bool
+	// NearCacheSize limits the size of keys and values cached in process for
+	// NearCacheTTL, 0 for no near cache.
+	NearCacheSize int
+	NearCacheTTL  time.Duration
+	Observer      Observer
+	// Logger logs cluster lifecycle events and dial failures, nil for no
+	// logging.
+	Logger *slog.Logger
+	// IdleConnTimeout closes connections idle for longer, 0 for no limit.
+	IdleConnTimeout time.Duration
+	// MaxConnLifetime closes connections dialed for longer once they are
+	// idle, so that e.g. rotated certificates are picked up, 0 for no limit.
+	MaxConnLifetime time.Duration
+	// MinIdleConnsPerThread connections of each thread are kept idle in
+	// background, it should not exceed MaxConnsPerThread.
+	MinIdleConnsPerThread int
+	// WarmUp dials MinIdleConnsPerThread connections of each thread before
+	// New and NewCluster return, dial failures are logged but not returned.
+	WarmUp bool
+	// Retry is the RetryPolicy of Cluster operations and cluster rebuilds.
+	Retry RetryPolicy
+	// Breaker configures the circuit breaker of each Cluster member.
+	Breaker BreakerConfig
+	// Degraded configures the degraded mode of Cluster.
+	Degraded DegradedConfig
+	// RefreshInterval polls the cluster in background about every interval,
+	// so that Cluster is rebuilt on a change before operations fail, 0 for
+	// no polling.
+	RefreshInterval time.Duration
 }
 
 func (conf *Config) check() error {
@@ -26,9 +64,49 @@ func (conf *Config) check() error {
 	if conf.MaxConnsPerThread <= 0 {
 		conf.MaxConnsPerThread = 0
 	}
+	if conf.NearCacheSize > 0 && conf.NearCacheTTL <= 0 {
+		return fmt.Errorf("bad NearCacheTTL: %d", conf.NearCacheTTL)
+	}
+	if conf.IdleConnTimeout < 0 {
+		return fmt.Errorf("bad IdleConnTimeout: %d", conf.IdleConnTimeout)
+	}
+	if conf.MaxConnLifetime < 0 {
+		return fmt.Errorf("bad MaxConnLifetime: %d", conf.MaxConnLifetime)
+	}
+	if conf.MinIdleConnsPerThread < 0 ||
+		(conf.MaxConnsPerThread > 0 && conf.MinIdleConnsPerThread > conf.MaxConnsPerThread) {
+		return fmt.Errorf("bad MinIdleConnsPerThread: %d", conf.MinIdleConnsPerThread)
+	}
+	if conf.Breaker.Failures < 0 {
+		return fmt.Errorf("bad Breaker.Failures: %d", conf.Breaker.Failures)
+	}
+	if conf.Breaker.Failures > 0 && conf.Breaker.OpenTimeout <= 0 {
+		return fmt.Errorf("bad Breaker.OpenTimeout: %d", conf.Breaker.OpenTimeout)
+	}
+	if conf.Degraded.Rate < 0 {
+		return fmt.Errorf("bad Degraded.Rate: %v", conf.Degraded.Rate)
+	}
+	if conf.RefreshInterval < 0 {
+		return fmt.Errorf("bad RefreshInterval: %d", conf.RefreshInterval)
+	}
+	if conf.Logger == nil {
+		conf.Logger = discardLogger
+	}
 	return nil
 }
 
+// Dialer returns the proto.Dialer of conf, which can be passed to the proto
+// dials WithDialer.
+func (conf *Config) Dialer() proto.Dialer {
+	return proto.Dialer{DialContext: conf.DialContext, TLSConfig: conf.TLSConfig}
+}
+
+// Admin returns the AdminConfig of conf, which can be passed to the admin
+// helpers.
+func (conf *Config) Admin() AdminConfig {
+	return AdminConfig{Dialer: conf.Dialer(), Retry: conf.Retry}
+}
+
 func (conf *Config) deadline() time.Time {
 	return time.Now().Add(conf.Timeout)
 }
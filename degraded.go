@@ -0,0 +1,316 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+var (
+	// errUncached is wrapped by the error returned with a value got from the
+	// fallback directly, in degraded mode or by Breaker.FailOpen, front
+	// returns the value with nil error instead.
+	errUncached = errors.New("value is not cached")
+	// ErrDelQueued is wrapped by the error of a Del queued in degraded mode,
+	// the Del is replayed when the cache recovers.
+	ErrDelQueued = errors.New("del is queued")
+	// errMemberDown is returned by the replay of a Del that is not tried,
+	// as the last replay on the member failed.
+	errMemberDown = errors.New("member is down")
+)
+
+const (
+	defaultMaxQueuedDels  = 4096
+	defaultReplayInterval = time.Second
+)
+
+// DegradedConfig configures the degraded mode of Cluster, in which
+// GetOrSet and MultiGetOrSet call the fallback directly if the cache fails
+// with a non-client-side error, and Del is queued. The value got from the
+// fallback directly is returned with nil error, and is reported by
+// Result.Uncached and OperationEvent.Uncached.
+type DegradedConfig struct {
+	Enabled bool
+	// Rate limits the fallback calls per second bypassing the cache, 0 for
+	// no limit. Calls over the limit get the error of the cache.
+	Rate  float64
+	Burst int // 0 for Rate, at least 1
+	// MaxQueuedDels limits the keys queued, 0 for 4096. Del gets the error
+	// of the cache if the queue is full.
+	MaxQueuedDels  int
+	ReplayInterval time.Duration // 0 for 1s
+}
+
+// degradable reports whether err of the cache can be bypassed.
+func degradable(err error) bool {
+	return err != nil && !errors.Is(err, proto.ErrClientSide) &&
+		!errors.Is(err, context.Canceled) && !errors.Is(err, errUncached)
+}
+
+// limiter is a token bucket, nil for no limit.
+type limiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	b := float64(burst)
+	if burst <= 0 {
+		b = max(rate, 1)
+	}
+	return &limiter{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+func (l *limiter) allow() bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// degraded is nil if the degraded mode is disabled.
+type degraded struct {
+	limiter        *limiter
+	maxQueued      int
+	replayInterval time.Duration
+	// replay deletes key, it should not queue key again. Unless probe, it
+	// may fail fast while the cache is known down.
+	replay func(ctx context.Context, key []byte, probe bool) error
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	closed    bool
+	replaying bool
+	seq       uint64
+	dels      map[string]uint64 // key to the seq when it is queued
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{} // closed when the replaying stops
+}
+
+func newDegraded(conf Config, replay func(ctx context.Context, key []byte, probe bool) error) *degraded {
+	d := conf.Degraded
+	if !d.Enabled {
+		return nil
+	}
+
+	maxQueued := d.MaxQueuedDels
+	if maxQueued <= 0 {
+		maxQueued = defaultMaxQueuedDels
+	}
+	interval := d.ReplayInterval
+	if interval <= 0 {
+		interval = defaultReplayInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &degraded{
+		limiter:        newLimiter(d.Rate, d.Burst),
+		maxQueued:      maxQueued,
+		replayInterval: interval,
+		replay:         replay,
+		logger:         conf.Logger,
+		dels:           make(map[string]uint64),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+}
+
+// getOrSet calls get directly if the cache failed with err.
+func (d *degraded) getOrSet(key []byte, get proto.FallbackGetFunc, err error) ([]byte, error) {
+	if d == nil || !degradable(err) || !d.limiter.allow() {
+		return nil, err
+	}
+
+	return uncachedGet(key, get, err)
+}
+
+// uncachedGet calls get directly for key the cache failed with err, the value
+// is returned with errUncached.
+func uncachedGet(key []byte, get proto.FallbackGetFunc, err error) ([]byte, error) {
+	val, ferr := directFallbackGet(key, get)
+	if ferr != nil {
+		return nil, ferr
+	}
+	return val, fmt.Errorf("%w: %w", errUncached, err)
+}
+
+// multiGetOrSet populates keys failed by a single call of get.
+func (d *degraded) multiGetOrSet(b *batch, get BatchFallbackGetFunc) {
+	if d == nil {
+		return
+	}
+
+	// the fallback is called once for all keys
+	if !slices.ContainsFunc(b.unique, func(i int) bool {
+		return degradable(b.results[i].Err)
+	}) || !d.limiter.allow() {
+		return
+	}
+
+	b.fallback(degradable, get)
+}
+
+// del queues key if the cache failed with err.
+func (d *degraded) del(key []byte, err error) error {
+	if d == nil || !degradable(err) {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return err
+	}
+	if _, ok := d.dels[string(key)]; !ok && len(d.dels) >= d.maxQueued {
+		return err
+	}
+
+	d.seq++
+	d.dels[string(key)] = d.seq
+	if !d.replaying {
+		d.replaying = true
+		d.done = make(chan struct{})
+		go d.run(d.done)
+	}
+	return fmt.Errorf("%w: %w", ErrDelQueued, err)
+}
+
+// flush replays the queued Del of key before the cache is read, so that the
+// value deleted in degraded mode is not served once the cache recovers. It
+// does not wait for a cache known down, the replaying goroutine probes it.
+func (d *degraded) flush(ctx context.Context, key []byte) error {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	seq, ok := d.dels[string(key)]
+	d.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	err := d.replay(ctx, key, false)
+	if err != nil {
+		return fmt.Errorf("replay del failed: %w", err)
+	}
+
+	d.mu.Lock()
+	if d.dels[string(key)] == seq {
+		delete(d.dels, string(key))
+	}
+	d.mu.Unlock()
+	return nil
+}
+
+// run replays queued dels until none is left.
+func (d *degraded) run(done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(d.replayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if d.replayOnce() {
+			return
+		}
+	}
+}
+
+// replayOnce returns true if there is no del left.
+func (d *degraded) replayOnce() bool {
+	d.mu.Lock()
+	dels := make(map[string]uint64, len(d.dels))
+	for key, seq := range d.dels {
+		dels[key] = seq
+	}
+	d.mu.Unlock()
+
+	for key, seq := range dels {
+		err := d.replay(d.ctx, []byte(key), true)
+		if err != nil {
+			d.logger.Warn("replay del failed", "left", len(dels), "error", err)
+			break
+		}
+
+		d.mu.Lock()
+		// the key is queued again during the replay
+		if d.dels[key] == seq {
+			delete(d.dels, key)
+		}
+		d.mu.Unlock()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.dels) == 0 || d.closed {
+		d.replaying = false
+		return true
+	}
+	return false
+}
+
+func (d *degraded) queued() int {
+	if d == nil {
+		return 0
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.dels)
+}
+
+// Close drops queued dels.
+func (d *degraded) Close() {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	d.closed = true
+	done := d.done
+	d.mu.Unlock()
+
+	d.cancel()
+	if done != nil {
+		<-done
+	}
+}
@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+func TestLimiter(t *testing.T) {
+	var none *limiter
+	if newLimiter(0, 10) != nil || !none.allow() {
+		t.Fatal("want no limit")
+	}
+
+	l := newLimiter(20, 2)
+	if !l.allow() || !l.allow() || l.allow() {
+		t.Fatal("want burst: 2")
+	}
+	time.Sleep(time.Second / 20)
+	if !l.allow() {
+		t.Fatal("want a token refilled")
+	}
+}
+
+func TestDegradable(t *testing.T) {
+	if !degradable(errors.New("down")) || !degradable(ErrCircuitOpen) {
+		t.Fatal("want cache failures degradable")
+	}
+	for _, err := range []error{nil, proto.ErrBadKeySize, proto.ErrFallbackGet, context.Canceled, errUncached} {
+		if degradable(err) {
+			t.Fatalf("want not degradable: %v", err)
+		}
+	}
+}
+
+func TestDegradedFlush(t *testing.T) {
+	down := errors.New("down")
+	var replayed int
+	d := newDegraded(Config{Degraded: DegradedConfig{Enabled: true, ReplayInterval: time.Hour}},
+		func(ctx context.Context, key []byte, probe bool) error {
+			replayed++
+			return down
+		})
+	defer d.Close()
+
+	if err := d.flush(context.Background(), []byte("key")); err != nil || replayed != 0 {
+		t.Fatalf("want no replay, got: %d %v", replayed, err)
+	}
+
+	if err := d.del([]byte("key"), down); !errors.Is(err, ErrDelQueued) {
+		t.Fatalf("want error: %v, got: %v", ErrDelQueued, err)
+	}
+	if err := d.flush(context.Background(), []byte("key")); !errors.Is(err, down) || d.queued() != 1 {
+		t.Fatalf("want del kept queued with error: %v, got: %d %v", down, d.queued(), err)
+	}
+
+	down = nil
+	if err := d.flush(context.Background(), []byte("key")); err != nil || d.queued() != 0 {
+		t.Fatalf("want del replayed, got: %d %v", d.queued(), err)
+	}
+	if replayed != 2 {
+		t.Fatalf("want replayed: 2, got: %d", replayed)
+	}
+}
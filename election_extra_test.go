@@ -9,6 +9,7 @@ import (
 
 func TestElectionWithUnstableLog(t *testing.T) {
 	param := InitTest(t)
+	SkipHermetic(t, param)
 
 	t.Run("Adjust", testClusterAdjust(param))
 	t.Run("Shrink", testClusterShrink(param))
@@ -40,6 +41,7 @@ func testElectionOnChangeAvailable(param TestParam) func(t *testing.T) {
 
 func TestElectionWithUnstableGrowLog(t *testing.T) {
 	param := InitTest(t)
+	SkipHermetic(t, param)
 
 	t.Run("ChangeAvailable", testElectionOnGrowChangeAvailable(param))
 	t.Run("Complete", testClusterGrow(param))
@@ -78,6 +80,7 @@ func testElectionOnGrowChangeAvailable(param TestParam) func(t *testing.T) {
 
 func TestVoteWithLog0(t *testing.T) {
 	param := InitTest(t)
+	SkipHermetic(t, param)
 
 	from := ADDRESSES_ADMIN4()
 	to := ADDRESSES_ADMIN8()
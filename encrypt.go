@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// An encrypted value is: encryptMagic, encryptVersion, key ID (4 bytes
+// little endian), nonce, and the sealed value. The header and the cache key
+// are authenticated as associated data, so that a value can not be replayed
+// under another key.
+const (
+	encryptMagic      = "\xffUE"
+	encryptVersion    = 1
+	encryptHeaderSize = len(encryptMagic) + 1 + 4
+	encryptNonceSize  = 12
+)
+
+var ErrPlaintext = errors.New("value is not encrypted")
+
+// Keyring provides the keys of AES-GCM, a key is 16, 24 or 32 bytes. A key ID
+// must never be reused for another key.
+type Keyring interface {
+	// Current returns the key to encrypt new values.
+	Current() (id uint32, key []byte, err error)
+	// Key returns the key to decrypt values encrypted by the key of id.
+	Key(id uint32) ([]byte, error)
+}
+
+// MapKeyring is a Keyring in memory, keys are rotated by adding a new key,
+// using it, and removing the old key after values encrypted by the old key
+// are expired.
+type MapKeyring struct {
+	mu      sync.RWMutex
+	current uint32
+	keys    map[uint32][]byte
+}
+
+// NewMapKeyring returns a MapKeyring using key of id.
+func NewMapKeyring(id uint32, key []byte) (*MapKeyring, error) {
+	k := &MapKeyring{keys: make(map[uint32][]byte)}
+	err := k.Add(id, key)
+	if err != nil {
+		return nil, err
+	}
+	k.current = id
+	return k, nil
+}
+
+func (k *MapKeyring) Add(id uint32, key []byte) error {
+	_, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[id]; ok {
+		return fmt.Errorf("key: %d exists", id)
+	}
+	k.keys[id] = bytes.Clone(key)
+	return nil
+}
+
+func (k *MapKeyring) Use(id uint32) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("key: %d not found", id)
+	}
+	k.current = id
+	return nil
+}
+
+func (k *MapKeyring) Remove(id uint32) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if id == k.current {
+		return fmt.Errorf("key: %d is in use", id)
+	}
+	delete(k.keys, id)
+	return nil
+}
+
+func (k *MapKeyring) Current() (uint32, []byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.current, k.keys[k.current], nil
+}
+
+func (k *MapKeyring) Key(id uint32) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("key: %d not found", id)
+	}
+	return key, nil
+}
+
+type EncryptConfig struct {
+	Keyring Keyring
+	// AllowPlaintext accepts values not encrypted, such as the values
+	// written before encryption is enabled.
+	AllowPlaintext bool
+}
+
+// Encrypted is a Cache that encrypts values by AES-GCM. Wrap it by
+// Compressed but not the other way, encrypted values do not compress.
+type Encrypted struct {
+	envelope
+	config EncryptConfig
+
+	mu    sync.Mutex
+	aeads map[uint32]cipher.AEAD
+}
+
+func NewEncrypted(cache Cache, config EncryptConfig) (*Encrypted, error) {
+	if config.Keyring == nil {
+		return nil, errors.New("bad EncryptConfig: nil Keyring")
+	}
+
+	e := &Encrypted{
+		config: config,
+		aeads:  make(map[uint32]cipher.AEAD),
+	}
+	e.envelope = envelope{cache: cache, encode: e.encode, decode: e.decode}
+	return e, nil
+}
+
+func (e *Encrypted) aead(id uint32, key []byte) (cipher.AEAD, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	aead, ok := e.aeads[id]
+	if ok {
+		return aead, nil
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("bad key: %d: %w", id, err)
+	}
+	aead, err = cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	e.aeads[id] = aead
+	return aead, nil
+}
+
+func encryptAAD(header, key []byte) []byte {
+	aad := make([]byte, 0, len(header)+len(key))
+	aad = append(aad, header...)
+	return append(aad, key...)
+}
+
+func (e *Encrypted) encode(key, val []byte) ([]byte, error) {
+	id, k, err := e.config.Keyring.Current()
+	if err != nil {
+		return nil, fmt.Errorf("get current key failed: %w", err)
+	}
+	aead, err := e.aead(id, k)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, encryptHeaderSize+encryptNonceSize, encryptHeaderSize+encryptNonceSize+len(val)+aead.Overhead())
+	copy(data, encryptMagic)
+	data[len(encryptMagic)] = encryptVersion
+	binary.LittleEndian.PutUint32(data[len(encryptMagic)+1:], id)
+	nonce := data[encryptHeaderSize:]
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("generate nonce failed: %w", err)
+	}
+
+	return aead.Seal(data, nonce, val, encryptAAD(data[:encryptHeaderSize], key)), nil
+}
+
+func (e *Encrypted) decode(key, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(encryptMagic)) {
+		if e.config.AllowPlaintext {
+			return data, nil
+		}
+		return nil, ErrPlaintext
+	}
+	if len(data) < encryptHeaderSize+encryptNonceSize {
+		return nil, errors.New("bad encrypted value")
+	}
+	if data[len(encryptMagic)] != encryptVersion {
+		return nil, fmt.Errorf("unknown encrypt version: %d", data[len(encryptMagic)])
+	}
+
+	id := binary.LittleEndian.Uint32(data[len(encryptMagic)+1:])
+	k, err := e.config.Keyring.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := e.aead(id, k)
+	if err != nil {
+		return nil, err
+	}
+
+	header := data[:encryptHeaderSize]
+	nonce := data[encryptHeaderSize : encryptHeaderSize+encryptNonceSize]
+	sealed := data[encryptHeaderSize+encryptNonceSize:]
+	val, err := aead.Open(nil, nonce, sealed, encryptAAD(header, key))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt by key: %d failed: %w", id, err)
+	}
+	return val, nil
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncrypted(t *testing.T) {
+	memory := NewMemory(KeySizeLimit, TIMEOUT)
+	keyring, err := NewMapKeyring(1, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := NewEncrypted(memory, EncryptConfig{Keyring: keyring})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encrypted.Close()
+
+	t.Run("Unreadable", testEncryptedUnreadable(encrypted, memory))
+	t.Run("Rotate", testEncryptedRotate(encrypted, keyring))
+	t.Run("Replay", testEncryptedReplay(encrypted, memory))
+
+	pool := NewPool(KeySizeLimit, CLIENT_FUZZ_N)
+	testBasic(t, encrypted, pool)
+}
+
+func encryptedDecodeError(t *testing.T, encrypted *Encrypted, tc Case) {
+	_, err := encrypted.GetOrSet(tc.Key, badFallbackGet)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("want DecodeError, got error: %v", err)
+	}
+}
+
+func testEncryptedUnreadable(encrypted *Encrypted, memory *Memory) func(t *testing.T) {
+	return func(t *testing.T) {
+		tc := Case{[]byte("pii"), []byte("alice@example.com")}
+		set(t, encrypted, tc)
+		hit(t, encrypted, tc)
+
+		raw, err := memory.GetOrSet(tc.Key, badFallbackGet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(raw, tc.Val) {
+			t.Fatal("value is readable")
+		}
+
+		plain := Case{[]byte("plain"), []byte("plain")}
+		set(t, memory, plain)
+		_, err = encrypted.GetOrSet(plain.Key, badFallbackGet)
+		if !errors.Is(err, ErrPlaintext) {
+			t.Fatalf("want error: %v, got error: %v", ErrPlaintext, err)
+		}
+	}
+}
+
+func testEncryptedRotate(encrypted *Encrypted, keyring *MapKeyring) func(t *testing.T) {
+	return func(t *testing.T) {
+		old := Case{[]byte("old"), []byte("old")}
+		set(t, encrypted, old)
+
+		err := keyring.Add(2, bytes.Repeat([]byte{2}, 16))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = keyring.Use(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tc := Case{[]byte("new"), []byte("new")}
+		set(t, encrypted, tc)
+		hit(t, encrypted, tc)
+		hit(t, encrypted, old)
+
+		err = keyring.Remove(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hit(t, encrypted, tc)
+		encryptedDecodeError(t, encrypted, old)
+	}
+}
+
+func testEncryptedReplay(encrypted *Encrypted, memory *Memory) func(t *testing.T) {
+	return func(t *testing.T) {
+		tc := Case{[]byte("alice"), []byte("admin")}
+		set(t, encrypted, tc)
+		raw, err := memory.GetOrSet(tc.Key, badFallbackGet)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		replay := Case{[]byte("mallory"), raw}
+		set(t, memory, replay)
+		encryptedDecodeError(t, encrypted, replay)
+	}
+}
@@ -0,0 +1,289 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+// errCollision is returned by decode for a value of another key, the value
+// is deleted and the key is got again.
+var errCollision = errors.New("key collision")
+
+// envelope is a Cache that transforms values before they are populated to
+// the underlying Cache, and back after they are got. A failed decode is
+// reported as DecodeError.
+type envelope struct {
+	cache  Cache
+	encode func(key, val []byte) ([]byte, error)
+	decode func(key, data []byte) ([]byte, error)
+	// key maps the key to the key of the underlying Cache, nil for no map.
+	key func(key []byte) []byte
+}
+
+func (e *envelope) cacheKey(key []byte) []byte {
+	if e.key == nil {
+		return key
+	}
+	return e.key(key)
+}
+
+func (e *envelope) _decode(key, data []byte) ([]byte, error) {
+	val, err := e.decode(key, data)
+	if err != nil && err != errCollision {
+		return nil, &DecodeError{key, err}
+	}
+	return val, err
+}
+
+type envelopeGetOrSetFunc func(key []byte, get proto.FallbackGetContextFunc) ([]byte, error)
+
+// fallbackCapture remembers the value got from the fallback of a wrapper,
+// the value is returned as is, instead of decoding what is encoded from it.
+type fallbackCapture[V any] struct {
+	val V
+	got bool
+}
+
+// captureFallback returns the fallback of the underlying Cache, which gets
+// the value of key by get and encodes it, nil if get is nil.
+func captureFallback[K, V any](c *fallbackCapture[V], key K, get func(ctx context.Context, key K) (V, error), encode func(ctx context.Context, val V) ([]byte, error)) proto.FallbackGetContextFunc {
+	if get == nil {
+		return nil
+	}
+
+	return func(ctx context.Context, _ []byte) ([]byte, error) {
+		v, err := get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := encode(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		c.val, c.got = v, true
+		return data, nil
+	}
+}
+
+func (e *envelope) getOrSet(ctx context.Context, key []byte, get proto.FallbackGetContextFunc, getOrSet envelopeGetOrSetFunc, del func(key []byte) error) ([]byte, error) {
+	k := e.cacheKey(key)
+	for retry := true; ; retry = false {
+		var c fallbackCapture[[]byte]
+		data, err := getOrSet(k, captureFallback(&c, key, get, func(_ context.Context, val []byte) ([]byte, error) {
+			return e.encode(key, val)
+		}))
+		if err != nil || c.got {
+			return c.val, err
+		}
+
+		val, err := e._decode(key, data)
+		if err != errCollision {
+			return val, err
+		}
+		// keys keep colliding, give up caching
+		if !retry {
+			if get == nil {
+				return nil, fmt.Errorf("%w: nil", proto.ErrFallbackGet)
+			}
+			return get(ctx, key)
+		}
+
+		err = del(k)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (e *envelope) GetOrSet(key []byte, get proto.FallbackGetFunc) ([]byte, error) {
+	getOrSet := func(key []byte, get proto.FallbackGetContextFunc) ([]byte, error) {
+		if get == nil {
+			return e.cache.GetOrSet(key, nil)
+		}
+		return e.cache.GetOrSet(key, func(key []byte) ([]byte, error) {
+			return get(context.Background(), key)
+		})
+	}
+	var _get proto.FallbackGetContextFunc
+	if get != nil {
+		_get = func(_ context.Context, key []byte) ([]byte, error) {
+			return get(key)
+		}
+	}
+	return e.getOrSet(context.Background(), key, _get, getOrSet, e.cache.Del)
+}
+
+func (e *envelope) GetOrSetContext(ctx context.Context, key []byte, get proto.FallbackGetContextFunc) ([]byte, error) {
+	getOrSet := func(key []byte, get proto.FallbackGetContextFunc) ([]byte, error) {
+		return e.cache.GetOrSetContext(ctx, key, get)
+	}
+	del := func(key []byte) error {
+		return e.cache.DelContext(ctx, key)
+	}
+	return e.getOrSet(ctx, key, get, getOrSet, del)
+}
+
+// envelopeBatch maps keys of the underlying Cache back, and remembers the
+// values got from the fallback.
+type envelopeBatch struct {
+	keys      [][]byte
+	cacheKeys [][]byte
+	original  map[string][]byte // nil for no map
+
+	mu  sync.Mutex
+	got map[string][]byte
+}
+
+func (e *envelope) newBatch(keys [][]byte) *envelopeBatch {
+	b := &envelopeBatch{keys: keys, cacheKeys: keys}
+	if e.key == nil {
+		return b
+	}
+
+	b.cacheKeys = make([][]byte, len(keys))
+	b.original = make(map[string][]byte, len(keys))
+	for i, key := range keys {
+		b.cacheKeys[i] = e.key(key)
+		b.original[string(b.cacheKeys[i])] = key
+	}
+	return b
+}
+
+func (e *envelope) encodeBatch(b *envelopeBatch, ctx context.Context, cacheKeys [][]byte, get BatchFallbackGetContextFunc) ([][]byte, error) {
+	keys := cacheKeys
+	if b.original != nil {
+		keys = make([][]byte, len(cacheKeys))
+		for i, k := range cacheKeys {
+			keys[i] = b.original[string(k)]
+		}
+	}
+
+	vals, err := get(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	// let the underlying Cache report the mismatch
+	if len(vals) != len(keys) {
+		return vals, nil
+	}
+
+	datas := make([][]byte, len(vals))
+	for i := range vals {
+		data, err := e.encode(keys[i], vals[i])
+		if err != nil {
+			return nil, err
+		}
+		datas[i] = data
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.got == nil {
+		b.got = make(map[string][]byte, len(keys))
+	}
+	for i := range keys {
+		b.got[string(keys[i])] = vals[i]
+	}
+	return datas, nil
+}
+
+// decodeBatch returns the indexes of collided keys.
+func (e *envelope) decodeBatch(b *envelopeBatch, results []Result) []int {
+	var collided []int
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+
+		if val, ok := b.got[string(b.keys[i])]; ok {
+			results[i].Val = val
+			continue
+		}
+		val, err := e._decode(b.keys[i], results[i].Val)
+		if err == errCollision {
+			collided = append(collided, i)
+			continue
+		}
+		results[i] = Result{Val: val, Err: err}
+	}
+	return collided
+}
+
+// fallbackOne gets a single key by a batch fallback.
+func fallbackOne(get BatchFallbackGetFunc, key []byte) ([]byte, error) {
+	vals, err := get([][]byte{key})
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) != 1 {
+		return nil, fmt.Errorf("got %d values for 1 key", len(vals))
+	}
+	return vals[0], nil
+}
+
+func (e *envelope) MultiGetOrSet(keys [][]byte, get BatchFallbackGetFunc) []Result {
+	if get == nil {
+		return e.MultiGetOrSetContext(context.Background(), keys, nil)
+	}
+
+	b := e.newBatch(keys)
+	_get := func(_ context.Context, keys [][]byte) ([][]byte, error) {
+		return get(keys)
+	}
+	results := e.cache.MultiGetOrSet(b.cacheKeys, func(keys [][]byte) ([][]byte, error) {
+		return e.encodeBatch(b, context.Background(), keys, _get)
+	})
+	for _, i := range e.decodeBatch(b, results) {
+		val, err := e.GetOrSet(keys[i], func(key []byte) ([]byte, error) {
+			return fallbackOne(get, key)
+		})
+		results[i] = Result{Val: val, Err: err}
+	}
+	return results
+}
+
+func (e *envelope) MultiGetOrSetContext(ctx context.Context, keys [][]byte, get BatchFallbackGetContextFunc) []Result {
+	b := e.newBatch(keys)
+	var fallback BatchFallbackGetContextFunc
+	if get != nil {
+		fallback = func(ctx context.Context, keys [][]byte) ([][]byte, error) {
+			return e.encodeBatch(b, ctx, keys, get)
+		}
+	}
+	results := e.cache.MultiGetOrSetContext(ctx, b.cacheKeys, fallback)
+	for _, i := range e.decodeBatch(b, results) {
+		var fallback proto.FallbackGetContextFunc
+		if get != nil {
+			fallback = func(ctx context.Context, key []byte) ([]byte, error) {
+				return fallbackOne(func(keys [][]byte) ([][]byte, error) {
+					return get(ctx, keys)
+				}, key)
+			}
+		}
+		val, err := e.GetOrSetContext(ctx, keys[i], fallback)
+		results[i] = Result{Val: val, Err: err}
+	}
+	return results
+}
+
+func (e *envelope) Del(key []byte) error {
+	return e.cache.Del(e.cacheKey(key))
+}
+
+func (e *envelope) DelContext(ctx context.Context, key []byte) error {
+	return e.cache.DelContext(ctx, e.cacheKey(key))
+}
+
+// Close closes the underlying Cache.
+func (e *envelope) Close() {
+	e.cache.Close()
+}
@@ -11,11 +11,14 @@ import (
 	"os"
 	"sync"
 	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
 )
 
 var exampleMu sync.RWMutex
 var exampleKey = []byte("hello")
 var exampleVal = []byte("umem-cache")
+var exampleOnce sync.Once
 
 func exampleConfig() (Config, error) {
 	cert, err := tls.LoadX509KeyPair("cert.pem", "key.pem")
@@ -41,11 +44,34 @@ func exampleConfig() (Config, error) {
 	}, nil
 }
 
+// exampleServe runs machines in process unless umem-cache is already serving.
+func exampleServe(config Config) {
+	exampleOnce.Do(func() {
+		conn, err := proto.Dial(DEADLINE(), "[::1]:10047", config.TLSConfig)
+		if err == nil {
+			conn.Close()
+			return
+		}
+
+		_, serverTLSConfig, err := LoadTLSConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		param := TestParam{Config: config, ServerTLSConfig: serverTLSConfig}
+		_, err = RunMachines([]int{10047, 10049, 10051, 10053}, param)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
 func exampleClient() (*Client, error) {
 	config, err := exampleConfig()
 	if err != nil {
 		return nil, fmt.Errorf("get example config failed: %w", err)
 	}
+	exampleServe(config)
 
 	return New("[::1]:10047", config)
 }
@@ -55,6 +81,7 @@ func exampleCluster() (*Cluster, error) {
 	if err != nil {
 		return nil, fmt.Errorf("get example config failed: %w", err)
 	}
+	exampleServe(config)
 
 	addresses := []string{
 		"[::1]:10048",
@@ -75,7 +102,7 @@ func exampleCluster() (*Cluster, error) {
 	}, config)
 }
 
-func exampleGetOrSet(client ClientInterface) {
+func exampleGetOrSet(client Cache) {
 	fallbackGet := func(key []byte) ([]byte, error) {
 		exampleMu.RLock()
 		defer exampleMu.RUnlock()
@@ -89,7 +116,7 @@ func exampleGetOrSet(client ClientInterface) {
 	fmt.Println(string(val))
 }
 
-func exampleDel(client ClientInterface) {
+func exampleDel(client Cache) {
 	// make sure the key will not cached during the deletion
 	exampleMu.Lock()
 	defer exampleMu.Unlock()
@@ -149,3 +176,11 @@ func ExampleCluster_Del() {
 	// Output:
 	// <nil>
 }
+
+func ExampleMemory() {
+	memory := NewMemory(KeySizeLimit, 3*time.Second)
+	defer memory.Close()
+
+	exampleGetOrSet(memory)
+	// Output: umem-cache
+}
@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+)
+
+// errFlightPanicked is got by callers joined a flight whose f panicked.
+var errFlightPanicked = errors.New("coalesced GetOrSet panicked")
+
+type flight struct {
+	done chan struct{}
+	val  []byte
+	err  error
+	// abandoned is set if the flight ended because its ctx is done, callers
+	// joined should start a new flight.
+	abandoned bool
+}
+
+// flightGroup coalesces concurrent GetOrSet of the same key.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+func newFlightGroup(coalesce bool) *flightGroup {
+	if !coalesce {
+		return nil
+	}
+	return &flightGroup{flights: make(map[string]*flight)}
+}
+
+func (g *flightGroup) join(key []byte) (*flight, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	fl, ok := g.flights[string(key)]
+	if ok {
+		return fl, true
+	}
+
+	fl = &flight{done: make(chan struct{})}
+	g.flights[string(key)] = fl
+	return fl, false
+}
+
+func (g *flightGroup) land(key []byte, fl *flight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.flights[string(key)] == fl {
+		delete(g.flights, string(key))
+	}
+	close(fl.done)
+}
+
+// do calls f once for concurrent callers of the same key, ctx is the ctx of
+// f, callers joined get a copy of the value.
+func (g *flightGroup) do(ctx context.Context, key []byte, f func() ([]byte, error)) ([]byte, error) {
+	for {
+		fl, joined := g.join(key)
+		if !joined {
+			return g.fly(ctx, key, fl, f)
+		}
+
+		select {
+		case <-fl.done:
+			if !fl.abandoned {
+				return bytes.Clone(fl.val), fl.err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// fly calls f for fl, fl lands even if f panics.
+func (g *flightGroup) fly(ctx context.Context, key []byte, fl *flight, f func() ([]byte, error)) ([]byte, error) {
+	fl.err = errFlightPanicked
+	defer func() {
+		fl.abandoned = ctx.Err() != nil
+		g.land(key, fl)
+	}()
+
+	fl.val, fl.err = f()
+	return fl.val, fl.err
+}
+
+// forget makes later callers of key start a new flight, so they will not get
+// the value populated before a Del.
+func (g *flightGroup) forget(key []byte) {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.flights, string(key))
+}
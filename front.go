@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+// front serves requests in process before they reach umem-cache.
+type front struct {
+	near     *nearCache
+	flights  *flightGroup
+	observer Observer
+}
+
+func newFront(config Config) front {
+	return front{
+		near:     newNearCache(config.NearCacheSize, config.NearCacheTTL),
+		flights:  newFlightGroup(config.Coalesce),
+		observer: config.Observer,
+	}
+}
+
+// bypassed reports whether requests can skip front.
+func (f *front) bypassed() bool {
+	return f.near == nil && f.flights == nil && f.observer == nil
+}
+
+func (f *front) getOrSet(ctx context.Context, key []byte, get proto.FallbackGetFunc, getOrSet func(get proto.FallbackGetFunc) ([]byte, error)) ([]byte, error) {
+	if f.observer == nil {
+		val, _, err := f.__getOrSet(ctx, key, get, getOrSet)
+		return val, err
+	}
+
+	o := fallbackObserver{start: time.Now()}
+	val, uncached, err := f.__getOrSet(ctx, key, o.wrap(get), getOrSet)
+	f.observer.OnOperation(OperationEvent{
+		Op:       OpGetOrSet,
+		KeySize:  len(key),
+		ValSize:  len(val),
+		Hit:      err == nil && !o.called,
+		Uncached: uncached,
+		Fallback: o.fallback,
+		Duration: time.Since(o.start),
+		Err:      err,
+	})
+	return val, err
+}
+
+// __getOrSet returns the value got from the fallback directly in degraded
+// mode with uncached set and nil error.
+func (f *front) __getOrSet(ctx context.Context, key []byte, get proto.FallbackGetFunc, getOrSet func(get proto.FallbackGetFunc) ([]byte, error)) (val []byte, uncached bool, err error) {
+	val, gen, ok := f.near.get(key)
+	if ok {
+		return val, false, nil
+	}
+
+	if f.flights == nil {
+		val, err = getOrSet(get)
+	} else {
+		val, err = f.flights.do(ctx, key, func() ([]byte, error) {
+			return getOrSet(get)
+		})
+	}
+	if err == nil {
+		f.near.set(key, val, gen)
+	}
+	if errors.Is(err, errUncached) {
+		return val, true, nil
+	}
+	return val, false, err
+}
+
+func (f *front) multiGetOrSet(keys [][]byte, get BatchFallbackGetFunc, run func(b *batch, get BatchFallbackGetFunc)) []Result {
+	if f.observer == nil {
+		return f.__multiGetOrSet(keys, get, run)
+	}
+
+	o := fallbackObserver{start: time.Now()}
+	missed := make(map[string]struct{})
+	results := f.__multiGetOrSet(keys, o.wrapBatch(get, missed), run)
+	duration := time.Since(o.start)
+	for i, r := range results {
+		_, miss := missed[string(keys[i])]
+		e := OperationEvent{
+			Op:       OpMultiGetOrSet,
+			KeySize:  len(keys[i]),
+			ValSize:  len(r.Val),
+			Hit:      r.Err == nil && !miss,
+			Uncached: r.Uncached,
+			Duration: duration,
+			Err:      r.Err,
+		}
+		if miss {
+			e.Fallback = o.fallback
+		}
+		f.observer.OnOperation(e)
+	}
+	return results
+}
+
+func (f *front) __multiGetOrSet(keys [][]byte, get BatchFallbackGetFunc, run func(b *batch, get BatchFallbackGetFunc)) []Result {
+	b := newBatch(keys)
+	if f.near == nil {
+		run(b, get)
+		return b.done()
+	}
+
+	var gen uint64
+	unique := b.unique[:0]
+	for n, i := range b.unique {
+		val, g, ok := f.near.get(keys[i])
+		if n == 0 {
+			gen = g
+		}
+		if ok {
+			b.results[i] = Result{Val: val}
+		} else {
+			unique = append(unique, i)
+		}
+	}
+	b.unique = unique
+
+	if len(b.unique) > 0 {
+		run(b, get)
+	}
+
+	for _, i := range b.unique {
+		if b.results[i].Err == nil && !b.results[i].Uncached {
+			f.near.set(keys[i], b.results[i].Val, gen)
+		}
+	}
+	return b.done()
+}
+
+func (f *front) invalidate(key []byte) {
+	f.near.del(key)
+	f.flights.forget(key)
+}
+
+// del invalidates key before and after del, so a value populated before del
+// will not be served after.
+func (f *front) del(key []byte, del func() error) error {
+	start := time.Now()
+	f.invalidate(key)
+	err := del()
+	f.invalidate(key)
+
+	if f.observer != nil {
+		f.observer.OnOperation(OperationEvent{
+			Op:       OpDel,
+			KeySize:  len(key),
+			Duration: time.Since(start),
+			Err:      err,
+		})
+	}
+	return err
+}
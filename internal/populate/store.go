@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+// Package populate holds values populated once per key, callers of a missed
+// key wait while another caller is populating it, like umem-cache does.
+package populate
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrClosed = errors.New("store is closed")
+
+type Entry struct {
+	Val  []byte
+	done chan struct{} // closed when populated
+}
+
+type Store struct {
+	mu      sync.Mutex
+	entries map[string]*Entry // nil for closed
+}
+
+func NewStore() *Store {
+	return &Store{entries: make(map[string]*Entry)}
+}
+
+// Acquire returns the populated entry of key, or a new entry the caller
+// should Populate or Abandon, it waits while another caller is populating key.
+func (s *Store) Acquire(ctx context.Context, key []byte) (e *Entry, populate bool, err error) {
+	for {
+		s.mu.Lock()
+		if s.entries == nil {
+			s.mu.Unlock()
+			return nil, false, ErrClosed
+		}
+
+		e = s.entries[string(key)]
+		if e == nil {
+			e = &Entry{done: make(chan struct{})}
+			s.entries[string(key)] = e
+			s.mu.Unlock()
+			return e, true, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-e.done:
+			s.mu.Lock()
+			populated := s.entries[string(key)] == e
+			s.mu.Unlock()
+			if populated {
+				return e, false, nil
+			}
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// Populate sets val to e, unless key is deleted while it is populating.
+func (s *Store) Populate(key []byte, e *Entry, val []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.entries != nil && s.entries[string(key)] == e {
+		e.Val = val
+	}
+	close(e.done)
+}
+
+// Abandon drops e, callers waiting for it acquire key again.
+func (s *Store) Abandon(key []byte, e *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.entries != nil && s.entries[string(key)] == e {
+		delete(s.entries, string(key))
+	}
+	close(e.done)
+}
+
+// Del drops the value of key, the populating value of key will be dropped.
+func (s *Store) Del(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.entries == nil {
+		return ErrClosed
+	}
+	delete(s.entries, string(key))
+	return nil
+}
+
+func (s *Store) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = nil
+}
@@ -0,0 +1,29 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"log/slog"
+)
+
+// attribute keys shared by all logs
+const (
+	logLeader  = "leader"
+	logVersion = "version"
+	logType    = "type"
+	logAddress = "address"
+	logThread  = "thread"
+)
+
+// discardHandler is used for no Config.Logger, slog.DiscardHandler needs
+// go1.24.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var discardLogger = slog.New(discardHandler{})
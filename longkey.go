@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// A key longer than the limit is stored under longKeyMagic and its SHA-256
+// digest, the value is: longKeyMagic, key size (uvarint), key, and the value.
+const (
+	longKeyMagic      = "\xffUK"
+	longKeyDigestSize = len(longKeyMagic) + sha256.Size
+)
+
+// LongKeys is a Cache that accepts keys of any size. A key no longer than
+// the limit is passed as is, a longer key is mapped to its digest, and the
+// digest collision is treated as a miss. Wrap LongKeys by other wrappers, so
+// that they see the original keys.
+type LongKeys struct {
+	envelope
+	keySizeLimit int
+}
+
+// NewLongKeys returns a LongKeys over cache, use KeySizeLimit for Client,
+// and ClusterKeySizeLimit for Cluster.
+func NewLongKeys(cache Cache, keySizeLimit int) (*LongKeys, error) {
+	if keySizeLimit < longKeyDigestSize {
+		return nil, fmt.Errorf("bad keySizeLimit: %d", keySizeLimit)
+	}
+
+	l := &LongKeys{keySizeLimit: keySizeLimit}
+	l.envelope = envelope{cache: cache, encode: l.encode, decode: l.decode, key: l.key}
+	return l, nil
+}
+
+func (l *LongKeys) long(key []byte) bool {
+	return len(key) > l.keySizeLimit
+}
+
+func (l *LongKeys) key(key []byte) []byte {
+	if !l.long(key) {
+		return key
+	}
+
+	digest := sha256.Sum256(key)
+	k := make([]byte, 0, longKeyDigestSize)
+	k = append(k, longKeyMagic...)
+	return append(k, digest[:]...)
+}
+
+func (l *LongKeys) encode(key, val []byte) ([]byte, error) {
+	if !l.long(key) {
+		return val, nil
+	}
+
+	data := make([]byte, 0, len(longKeyMagic)+binary.MaxVarintLen64+len(key)+len(val))
+	data = append(data, longKeyMagic...)
+	data = binary.AppendUvarint(data, uint64(len(key)))
+	data = append(data, key...)
+	return append(data, val...), nil
+}
+
+func (l *LongKeys) decode(key, data []byte) ([]byte, error) {
+	if !l.long(key) {
+		return data, nil
+	}
+
+	if !bytes.HasPrefix(data, []byte(longKeyMagic)) {
+		// stored under the digest by a short key
+		return nil, errCollision
+	}
+
+	data = data[len(longKeyMagic):]
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size > uint64(len(data)-n) {
+		return nil, errors.New("bad long key envelope")
+	}
+
+	data = data[n:]
+	if !bytes.Equal(data[:size], key) {
+		return nil, errCollision
+	}
+	return data[size:], nil
+}
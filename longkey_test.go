@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLongKeys(t *testing.T) {
+	memory := NewMemory(ClusterKeySizeLimit, TIMEOUT)
+	longKeys, err := NewLongKeys(memory, ClusterKeySizeLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer longKeys.Close()
+
+	t.Run("Collision", testLongKeysCollision(longKeys, memory))
+
+	pool := NewPool(4*KeySizeLimit, CLIENT_FUZZ_N)
+	testBasic(t, longKeys, pool)
+}
+
+func testLongKeysCollision(longKeys *LongKeys, memory *Memory) func(t *testing.T) {
+	return func(t *testing.T) {
+		tc := Case{bytes.Repeat([]byte("k"), 1000), []byte("val")}
+		other := Case{bytes.Repeat([]byte("o"), 1000), []byte("other")}
+		data, err := longKeys.encode(other.Key, other.Val)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// pretend other collides with tc
+		set(t, memory, Case{longKeys.key(tc.Key), data})
+		check(t, longKeys, tc)
+		hit(t, longKeys, tc)
+
+		set(t, memory, Case{longKeys.key(tc.Key), data})
+		results := longKeys.MultiGetOrSet([][]byte{tc.Key}, func(keys [][]byte) ([][]byte, error) {
+			return [][]byte{tc.Val}, nil
+		})
+		if results[0].Err != nil || string(results[0].Val) != string(tc.Val) {
+			t.Fatalf("want: %v, got: %v", tc, results[0])
+		}
+		hit(t, longKeys, tc)
+
+		short := Case{longKeys.key(tc.Key), []byte("short")}
+		set(t, longKeys, short)
+		check(t, longKeys, tc)
+		hit(t, longKeys, tc)
+	}
+}
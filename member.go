@@ -4,7 +4,11 @@
 package client
 
 import (
+	"context"
 	"encoding/binary"
+	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/imchuncai/umem-cache-client-Go/proto"
@@ -14,9 +18,35 @@ type member struct {
 	version uint64
 	address string
 	threads []thread
+	keeper  *keeper
+	breaker *breaker
+	// replayFailed is set if the last replay of a Del queued in degraded
+	// mode failed, the member is taken as down until a replay succeeds.
+	replayFailed *atomic.Bool
 }
 
-func newMembers(machines []proto.Machine, conf Config) []member {
+// memberCounters are the threadCounters of members by address, so that they
+// survive rebuilds of the cluster.
+type memberCounters map[string][]threadCounters
+
+// renew returns the counters of machines, counters of machines left are
+// dropped.
+func (counters memberCounters) renew(machines []proto.Machine, threadNR int) memberCounters {
+	renewed := make(memberCounters, len(machines))
+	for _, m := range machines {
+		address := m.Addr.String()
+		c, ok := counters[address]
+		if !ok {
+			c = make([]threadCounters, threadNR)
+		}
+		renewed[address] = c
+	}
+	return renewed
+}
+
+// newMembers fills idle connections before return if warmUp, counters should
+// be renewed for machines.
+func newMembers(machines []proto.Machine, conf Config, warmUp bool, counters memberCounters) []member {
 	var route string
 	for _, m := range machines {
 		if m.Available() {
@@ -31,36 +61,78 @@ func newMembers(machines []proto.Machine, conf Config) []member {
 		if m.Available() {
 			route = m.Addr.String()
 		}
-		members[i].init(m, route, conf)
+		members[i].init(m, route, conf, counters[m.Addr.String()])
+	}
+
+	if warmUp {
+		groups := make([][]thread, len(members))
+		for i := range members {
+			groups[i] = members[i].threads
+		}
+		fill(context.Background(), conf.deadline(), groups...)
+	}
+
+	for i := range members {
+		members[i].keeper = startKeeper(members[i].threads, conf)
 	}
 	return members
 }
 
-func (m *member) init(machine proto.Machine, route string, conf Config) {
+func (m *member) init(machine proto.Machine, route string, conf Config, counters []threadCounters) {
 	m.version = machine.Version
 	m.address = machine.Addr.String()
-	m.threads = newThreads(route, conf)
+	m.threads = newThreads(route, conf, counters)
+	m.breaker = newBreaker(conf.Breaker)
+	m.replayFailed = new(atomic.Bool)
 }
 
 func (m *member) Close() {
+	m.keeper.Stop()
 	for i := range m.threads {
 		m.threads[i].Close()
 	}
 }
 
+func (m *member) appendRealKey(dst, key []byte) []byte {
+	dst = binary.LittleEndian.AppendUint64(dst, m.version)
+	return append(dst, key...)
+}
+
 func (m *member) realKey(key []byte) []byte {
-	k := make([]byte, 8+len(key))
-	binary.LittleEndian.PutUint64(k, m.version)
-	copy(k[8:], key)
-	return k
+	return m.appendRealKey(make([]byte, 0, 8+len(key)), key)
+}
+
+var realKeyPool = sync.Pool{
+	New: func() any { return new([KeySizeLimit]byte) },
 }
 
-func (m *member) GetOrSet(deadline time.Time, threadID uint64, key []byte, get proto.FallbackGetFunc) (val []byte, err error) {
+// GetOrSetAppend takes the real key from realKeyPool.
+func (m *member) GetOrSetAppend(ctx context.Context, deadline time.Time, threadID uint64, dst, key []byte, get proto.FallbackGetFunc) ([]byte, error) {
+	buf := realKeyPool.Get().(*[KeySizeLimit]byte)
+	defer realKeyPool.Put(buf)
+
+	// a key out of limit is rejected by the request
+	realKey := m.appendRealKey(buf[:0], key)
+	return m.threads[threadID].GetOrSetAppend(ctx, deadline, dst, realKey, get)
+}
+
+func (m *member) GetOrSet(ctx context.Context, deadline time.Time, threadID uint64, key []byte, get proto.FallbackGetFunc) (val []byte, err error) {
 	key = m.realKey(key)
-	return m.threads[threadID].GetOrSet(deadline, key, get)
+	return m.threads[threadID].GetOrSet(ctx, deadline, key, get)
+}
+
+func (m *member) GetOrSetStream(ctx context.Context, deadline time.Time, timeout time.Duration, threadID uint64, key []byte, get StreamFallbackGetFunc) (*stream, error) {
+	realKey := m.realKey(key)
+	if get != nil {
+		_get := get
+		get = func(ctx context.Context, _ []byte) (io.Reader, int64, error) {
+			return _get(ctx, key)
+		}
+	}
+	return m.threads[threadID].GetOrSetStream(ctx, deadline, timeout, realKey, get)
 }
 
-func (m *member) Del(deadline time.Time, threadID uint64, key []byte) error {
+func (m *member) Del(ctx context.Context, deadline time.Time, threadID uint64, key []byte) error {
 	key = m.realKey(key)
-	return m.threads[threadID].Del(deadline, key)
+	return m.threads[threadID].Del(ctx, deadline, key)
 }
@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/internal/populate"
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+// Memory is an in-process Cache that behaves like umem-cache, it is meant
+// for tests of code that builds on Cache.
+type Memory struct {
+	keySizeLimit int
+	timeout      time.Duration
+	store        *populate.Store
+}
+
+// NewMemory returns a Memory that accepts keys no longer than keySizeLimit,
+// use KeySizeLimit to act like Client, and ClusterKeySizeLimit like Cluster.
+func NewMemory(keySizeLimit int, timeout time.Duration) *Memory {
+	return &Memory{
+		keySizeLimit: keySizeLimit,
+		timeout:      timeout,
+		store:        populate.NewStore(),
+	}
+}
+
+func (m *Memory) deadline() time.Time {
+	return time.Now().Add(m.timeout)
+}
+
+func (m *Memory) getOrSet(ctx context.Context, key []byte, get proto.FallbackGetFunc) ([]byte, error) {
+	if len(key) > m.keySizeLimit {
+		return nil, fmt.Errorf("get failed: %w", proto.ErrBadKeySize)
+	}
+
+	e, miss, err := m.store.Acquire(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("get failed: %w", err)
+	}
+
+	if !miss {
+		return append([]byte{}, e.Val...), nil
+	}
+
+	if get == nil {
+		m.store.Abandon(key, e)
+		return nil, fmt.Errorf("%w: nil", proto.ErrFallbackGet)
+	}
+
+	val, err := get(key)
+	if err != nil {
+		m.store.Abandon(key, e)
+		return nil, fmt.Errorf("%w: %w", proto.ErrFallbackGet, err)
+	}
+
+	m.store.Populate(key, e, append([]byte{}, val...))
+	return val, nil
+}
+
+func (m *Memory) GetOrSet(key []byte, get proto.FallbackGetFunc) ([]byte, error) {
+	ctx, cancel := context.WithDeadline(context.Background(), m.deadline())
+	defer cancel()
+
+	return m.getOrSet(ctx, key, get)
+}
+
+func (m *Memory) GetOrSetContext(ctx context.Context, key []byte, get proto.FallbackGetContextFunc) ([]byte, error) {
+	ctx, cancel := context.WithDeadline(ctx, m.deadline())
+	defer cancel()
+
+	return m.getOrSet(ctx, key, fallbackWithContext(ctx, get))
+}
+
+func (m *Memory) MultiGetOrSet(keys [][]byte, get BatchFallbackGetFunc) []Result {
+	ctx, cancel := context.WithDeadline(context.Background(), m.deadline())
+	defer cancel()
+
+	return m.multiGetOrSet(ctx, keys, get)
+}
+
+func (m *Memory) MultiGetOrSetContext(ctx context.Context, keys [][]byte, get BatchFallbackGetContextFunc) []Result {
+	ctx, cancel := context.WithDeadline(ctx, m.deadline())
+	defer cancel()
+
+	return m.multiGetOrSet(ctx, keys, batchFallbackWithContext(ctx, get))
+}
+
+func (m *Memory) multiGetOrSet(ctx context.Context, keys [][]byte, get BatchFallbackGetFunc) []Result {
+	b := newBatch(keys)
+	unique := slices.Clone(b.unique)
+	slices.SortFunc(unique, func(i, j int) int {
+		return bytes.Compare(keys[i], keys[j])
+	})
+
+	var missed [][]byte
+	var misses []int
+	var entries []*populate.Entry
+	for _, i := range unique {
+		if len(keys[i]) > m.keySizeLimit {
+			b.results[i] = Result{Err: fmt.Errorf("get failed: %w", proto.ErrBadKeySize)}
+			continue
+		}
+
+		e, miss, err := m.store.Acquire(ctx, keys[i])
+		if err != nil {
+			b.results[i] = Result{Err: fmt.Errorf("get failed: %w", err)}
+		} else if !miss {
+			b.results[i] = Result{Val: append([]byte{}, e.Val...)}
+		} else {
+			missed = append(missed, keys[i])
+			misses = append(misses, i)
+			entries = append(entries, e)
+		}
+	}
+
+	if len(misses) == 0 {
+		return b.done()
+	}
+
+	vals, err := batchFallbackGet(missed, get)
+	for n, i := range misses {
+		if err != nil {
+			m.store.Abandon(keys[i], entries[n])
+			b.results[i] = Result{Err: err}
+		} else {
+			m.store.Populate(keys[i], entries[n], append([]byte{}, vals[n]...))
+			b.results[i] = Result{Val: vals[n]}
+		}
+	}
+	return b.done()
+}
+
+// Del never waits for a populating key, the populating value will be dropped.
+func (m *Memory) Del(key []byte) error {
+	return m.DelContext(context.Background(), key)
+}
+
+func (m *Memory) DelContext(ctx context.Context, key []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(key) > m.keySizeLimit {
+		return fmt.Errorf("write cmd failed: %w", proto.ErrBadKeySize)
+	}
+
+	return m.store.Del(key)
+}
+
+func (m *Memory) Close() {
+	m.store.Close()
+}
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+func TestMemory(t *testing.T) {
+	memory := NewMemory(KeySizeLimit, TIMEOUT)
+	defer memory.Close()
+
+	t.Run("BadKeySize", testMemoryBadKeySize(memory))
+	t.Run("Populate", testMemoryPopulate(memory))
+
+	pool := NewPool(KeySizeLimit, CLIENT_FUZZ_N)
+	testBasic(t, memory, pool)
+}
+
+func testMemoryBadKeySize(memory *Memory) func(t *testing.T) {
+	return func(t *testing.T) {
+		tc := Case{make([]byte, KeySizeLimit+1), nil}
+
+		_, err := memory.GetOrSet(tc.Key, fallbackGet(tc))
+		if !errors.Is(err, proto.ErrBadKeySize) {
+			t.Fatalf("want error: %v, got error: %v", proto.ErrBadKeySize, err)
+		}
+
+		err = memory.Del(tc.Key)
+		if !errors.Is(err, proto.ErrBadKeySize) {
+			t.Fatalf("want error: %v, got error: %v", proto.ErrBadKeySize, err)
+		}
+	}
+}
+
+func testMemoryPopulate(memory *Memory) func(t *testing.T) {
+	return func(t *testing.T) {
+		tc := Case{[]byte("hello"), []byte("world")}
+		del(t, memory, tc)
+
+		populating := make(chan struct{})
+		release := make(chan struct{})
+		go func() {
+			_, err := memory.GetOrSet(tc.Key, func(key []byte) ([]byte, error) {
+				close(populating)
+				<-release
+				return tc.Val, nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+
+		<-populating
+		go close(release)
+		_, err := memory.GetOrSet(tc.Key, badFallbackGet)
+		if err != nil {
+			t.Fatalf("waiter should not fallback get: %v", err)
+		}
+		check(t, memory, tc)
+	}
+}
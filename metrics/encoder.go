@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package metrics
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// buckets are the upper bounds in seconds, same as the Prometheus defaults.
+var buckets = [...]float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts [len(buckets)]uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	v := d.Seconds()
+	for i, le := range buckets {
+		if v <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// labels is a list of name value pairs.
+type labels []string
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) header(name, _type, help string) {
+	e.buf = append(e.buf, "# HELP "...)
+	e.buf = append(e.buf, name...)
+	e.buf = append(e.buf, ' ')
+	e.buf = append(e.buf, escapeHelp(help)...)
+	e.buf = append(e.buf, "\n# TYPE "...)
+	e.buf = append(e.buf, name...)
+	e.buf = append(e.buf, ' ')
+	e.buf = append(e.buf, _type...)
+	e.buf = append(e.buf, '\n')
+}
+
+func (e *encoder) sample(name string, l labels, v float64) {
+	e.buf = append(e.buf, name...)
+	if len(l) > 0 {
+		e.buf = append(e.buf, '{')
+		for i := 0; i < len(l); i += 2 {
+			if i > 0 {
+				e.buf = append(e.buf, ',')
+			}
+			e.buf = append(e.buf, l[i]...)
+			e.buf = append(e.buf, `="`...)
+			e.buf = append(e.buf, escapeLabel(l[i+1])...)
+			e.buf = append(e.buf, '"')
+		}
+		e.buf = append(e.buf, '}')
+	}
+	e.buf = append(e.buf, ' ')
+	e.buf = appendFloat(e.buf, v)
+	e.buf = append(e.buf, '\n')
+}
+
+func (e *encoder) counter(name, help string, v uint64) {
+	e.header(name, "counter", help)
+	e.sample(name, nil, float64(v))
+}
+
+func (e *encoder) histogram(name string, l labels, h *histogram) {
+	var cumulative uint64
+	for i, le := range buckets {
+		cumulative += h.counts[i]
+		e.sample(name+"_bucket", append(l[:len(l):len(l)], "le", formatFloat(le)), float64(cumulative))
+	}
+	e.sample(name+"_bucket", append(l[:len(l):len(l)], "le", "+Inf"), float64(h.count))
+	e.sample(name+"_sum", l, h.sum)
+	e.sample(name+"_count", l, float64(h.count))
+}
+
+func appendFloat(dst []byte, v float64) []byte {
+	switch {
+	case math.IsInf(v, 1):
+		return append(dst, "+Inf"...)
+	case math.IsInf(v, -1):
+		return append(dst, "-Inf"...)
+	case math.IsNaN(v):
+		return append(dst, "NaN"...)
+	}
+	return strconv.AppendFloat(dst, v, 'g', -1, 64)
+}
+
+func formatFloat(v float64) string {
+	return string(appendFloat(nil, v))
+}
+
+func itoa(i int) string {
+	return strconv.Itoa(i)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,338 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+// Package metrics exports client metrics in the Prometheus text exposition
+// format, using the standard library only.
+//
+//	collector := metrics.NewCollector()
+//	config.Observer = collector
+//	cluster, err := client.NewCluster(addrs, config)
+//	collector.Register("default", cluster)
+//	http.Handle("/metrics", collector)
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	client "github.com/imchuncai/umem-cache-client-Go"
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+// StatsSource is implemented by *client.Client and *client.Cluster.
+type StatsSource interface {
+	Stats() client.Stats
+}
+
+const (
+	outcomeHit   = "hit"
+	outcomeMiss  = "miss"
+	outcomeOK    = "ok"
+	outcomeError = "error"
+	// degraded mode
+	outcomeUncached = "uncached"
+	outcomeQueued   = "queued"
+)
+
+type opKey struct {
+	op      client.Operation
+	outcome string
+}
+
+// Collector is a client.Observer and an http.Handler.
+type Collector struct {
+	mu         sync.Mutex
+	operations map[opKey]uint64
+	durations  map[client.Operation]*histogram
+	fallback   histogram
+	ticketWait histogram
+	dials      uint64
+	dialErrs   uint64
+	closes     uint64
+	closeErrs  uint64
+	retries    uint64
+	rebuilds   uint64
+	rebuildErr uint64
+	sources    map[string]StatsSource
+}
+
+var _ client.Observer = (*Collector)(nil)
+var _ http.Handler = (*Collector)(nil)
+
+func NewCollector() *Collector {
+	return &Collector{
+		operations: make(map[opKey]uint64),
+		durations:  make(map[client.Operation]*histogram),
+		sources:    make(map[string]StatsSource),
+	}
+}
+
+// Register adds a source of gauges, labeled by name. Registering the same
+// name again replaces the source.
+func (c *Collector) Register(name string, source StatsSource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sources[name] = source
+}
+
+func (c *Collector) Unregister(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.sources, name)
+}
+
+func outcome(e client.OperationEvent) string {
+	switch {
+	case e.Uncached:
+		return outcomeUncached
+	case errors.Is(e.Err, client.ErrDelQueued):
+		return outcomeQueued
+	case e.Err != nil:
+		return outcomeError
+	case e.Op == client.OpDel:
+		return outcomeOK
+	case e.Hit:
+		return outcomeHit
+	default:
+		return outcomeMiss
+	}
+}
+
+func (c *Collector) OnOperation(e client.OperationEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.operations[opKey{e.Op, outcome(e)}]++
+	h, ok := c.durations[e.Op]
+	if !ok {
+		h = new(histogram)
+		c.durations[e.Op] = h
+	}
+	h.observe(e.Duration)
+	if e.Op != client.OpDel && !e.Hit && e.Err == nil {
+		c.fallback.observe(e.Fallback)
+	}
+}
+
+func (c *Collector) OnDial(address string, threadID uint32, duration time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.dials++
+	if err != nil {
+		c.dialErrs++
+	}
+}
+
+func (c *Collector) OnConnClose(address string, threadID uint32, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closes++
+	if err != nil {
+		c.closeErrs++
+	}
+}
+
+func (c *Collector) OnTicketWait(address string, threadID uint32, wait time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ticketWait.observe(wait)
+}
+
+func (c *Collector) OnRetry(attempt int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.retries++
+}
+
+func (c *Collector) OnClusterRebuild(cluster proto.Cluster, leader string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rebuilds++
+	if err != nil {
+		c.rebuildErr++
+	}
+}
+
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(c.Render())
+}
+
+// Render returns all metrics in the Prometheus text exposition format.
+func (c *Collector) Render() []byte {
+	c.mu.Lock()
+	names, sources := c.__sources()
+	var e encoder
+	c.__render(&e)
+	c.mu.Unlock()
+
+	// Stats() takes the locks of the clients, do not hold ours.
+	stats := make([]client.Stats, len(sources))
+	for i := range sources {
+		stats[i] = sources[i].Stats()
+	}
+	renderStats(&e, names, stats)
+	return e.buf
+}
+
+func (c *Collector) __sources() ([]string, []StatsSource) {
+	names := make([]string, 0, len(c.sources))
+	for name := range c.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sources := make([]StatsSource, len(names))
+	for i, name := range names {
+		sources[i] = c.sources[name]
+	}
+	return names, sources
+}
+
+func (c *Collector) __render(e *encoder) {
+	keys := make([]opKey, 0, len(c.operations))
+	for k := range c.operations {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].op != keys[j].op {
+			return keys[i].op < keys[j].op
+		}
+		return keys[i].outcome < keys[j].outcome
+	})
+
+	e.header("umem_cache_operations_total", "counter", "Operations by type and outcome, counted per key.")
+	for _, k := range keys {
+		e.sample("umem_cache_operations_total", labels{"op", k.op.String(), "outcome", k.outcome}, float64(c.operations[k]))
+	}
+
+	var hits, misses uint64
+	for k, n := range c.operations {
+		switch k.outcome {
+		case outcomeHit:
+			hits += n
+		case outcomeMiss:
+			misses += n
+		}
+	}
+	e.header("umem_cache_hit_ratio", "gauge", "Hits divided by hits and misses since start.")
+	if hits+misses > 0 {
+		e.sample("umem_cache_hit_ratio", nil, float64(hits)/float64(hits+misses))
+	} else {
+		e.sample("umem_cache_hit_ratio", nil, 0)
+	}
+
+	ops := make([]client.Operation, 0, len(c.durations))
+	for op := range c.durations {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i] < ops[j] })
+	e.header("umem_cache_operation_duration_seconds", "histogram", "Operation latency by type.")
+	for _, op := range ops {
+		e.histogram("umem_cache_operation_duration_seconds", labels{"op", op.String()}, c.durations[op])
+	}
+
+	e.header("umem_cache_fallback_duration_seconds", "histogram", "Time spent in fallbacks.")
+	e.histogram("umem_cache_fallback_duration_seconds", nil, &c.fallback)
+
+	e.header("umem_cache_ticket_wait_seconds", "histogram", "Time spent waiting for a connection ticket.")
+	e.histogram("umem_cache_ticket_wait_seconds", nil, &c.ticketWait)
+
+	e.counter("umem_cache_dials_total", "Connections dialed.", c.dials)
+	e.counter("umem_cache_dial_failures_total", "Connections failed to dial.", c.dialErrs)
+	e.header("umem_cache_conn_closes_total", "counter", "Connections closed, by reason.")
+	e.sample("umem_cache_conn_closes_total", labels{"reason", "error"}, float64(c.closeErrs))
+	e.sample("umem_cache_conn_closes_total", labels{"reason", "close"}, float64(c.closes-c.closeErrs))
+	e.counter("umem_cache_retries_total", "Cluster operations retried.", c.retries)
+	e.header("umem_cache_cluster_rebuilds_total", "counter", "Cluster rebuilds changing the cluster or failed, by outcome.")
+	e.sample("umem_cache_cluster_rebuilds_total", labels{"outcome", outcomeOK}, float64(c.rebuilds-c.rebuildErr))
+	e.sample("umem_cache_cluster_rebuilds_total", labels{"outcome", outcomeError}, float64(c.rebuildErr))
+}
+
+func renderStats(e *encoder, names []string, stats []client.Stats) {
+	if len(names) == 0 {
+		return
+	}
+
+	type gauge struct {
+		name, help string
+		value      func(t client.ThreadStats) int
+	}
+	gauges := [...]gauge{
+		{"umem_cache_idle_conns", "Idle connections per thread.",
+			func(t client.ThreadStats) int { return t.IdleConns }},
+		{"umem_cache_tickets_in_use", "Connection tickets in use per thread.",
+			func(t client.ThreadStats) int { return t.TicketsInUse }},
+		{"umem_cache_max_conns", "Connection limit per thread, 0 for no limit.",
+			func(t client.ThreadStats) int { return t.MaxConns }},
+	}
+	for _, g := range gauges {
+		e.header(g.name, "gauge", g.help)
+		for i, s := range stats {
+			for _, m := range s.Members {
+				for id, t := range m.Threads {
+					l := labels{"client", names[i], "member", m.Address, "thread", itoa(id)}
+					e.sample(g.name, l, float64(g.value(t)))
+				}
+			}
+		}
+	}
+
+	// the cluster gauges are meaningless for a single server Client
+	var cluster []int
+	for i := range stats {
+		if stats[i].Leader != "" {
+			cluster = append(cluster, i)
+		}
+	}
+	if len(cluster) > 0 {
+		e.header("umem_cache_authority_queue_depth", "gauge", "Requests waiting for an authority permission.")
+		for _, i := range cluster {
+			e.sample("umem_cache_authority_queue_depth", labels{"client", names[i]}, float64(stats[i].AuthorityQueue))
+		}
+		e.header("umem_cache_queued_dels", "gauge", "Dels queued for replay in degraded mode.")
+		for _, i := range cluster {
+			e.sample("umem_cache_queued_dels", labels{"client", names[i]}, float64(stats[i].QueuedDels))
+		}
+		e.header("umem_cache_cluster_version", "gauge", "Cluster version.")
+		for _, i := range cluster {
+			e.sample("umem_cache_cluster_version", labels{"client", names[i]}, float64(stats[i].Version))
+		}
+		e.header("umem_cache_cluster_type", "gauge", "Cluster type, the value is the raw type.")
+		for _, i := range cluster {
+			t := stats[i].Type
+			e.sample("umem_cache_cluster_type", labels{"client", names[i], "type", t.String()}, float64(t))
+		}
+		e.header("umem_cache_breaker_state", "gauge", "Circuit breaker state per member, the value is the raw state.")
+		for _, i := range cluster {
+			for _, m := range stats[i].Members {
+				st := m.Breaker.State
+				l := labels{"client", names[i], "member", m.Address, "state", st.String()}
+				e.sample("umem_cache_breaker_state", l, float64(st))
+			}
+		}
+	}
+	e.header("umem_cache_near_cache_entries", "gauge", "Entries in the near cache.")
+	for i, s := range stats {
+		e.sample("umem_cache_near_cache_entries", labels{"client", names[i]}, float64(s.NearCache.Entries))
+	}
+}
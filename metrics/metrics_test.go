@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	client "github.com/imchuncai/umem-cache-client-Go"
+	"github.com/imchuncai/umem-cache-client-Go/umemtest"
+)
+
+func TestCollector(t *testing.T) {
+	server, err := umemtest.NewServer("[::1]:0", umemtest.Config{
+		ThreadNR:          2,
+		MaxConnsPerThread: 4,
+		Timeout:           time.Second,
+	})
+	if err != nil {
+		t.Fatalf("start server failed: %v", err)
+	}
+	defer server.Close()
+
+	collector := NewCollector()
+	c, err := client.New(server.Addr(), client.Config{
+		Timeout:  time.Second,
+		ThreadNR: 2,
+		Observer: collector,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer c.Close()
+	collector.Register(`a"b`, c)
+
+	get := func(key []byte) ([]byte, error) { return []byte("val"), nil }
+	for i := 0; i < 3; i++ {
+		_, err := c.GetOrSet([]byte("key"), get)
+		if err != nil {
+			t.Fatalf("GetOrSet failed: %v", err)
+		}
+	}
+	err = c.Del([]byte("key"))
+	if err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	collector.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type: %q", ct)
+	}
+	body, _ := io.ReadAll(w.Body)
+	text := string(body)
+
+	expects := []string{
+		"# TYPE umem_cache_operations_total counter\n",
+		`umem_cache_operations_total{op="get_or_set",outcome="hit"} 2` + "\n",
+		`umem_cache_operations_total{op="get_or_set",outcome="miss"} 1` + "\n",
+		`umem_cache_operations_total{op="del",outcome="ok"} 1` + "\n",
+		"umem_cache_hit_ratio 0.6666666666666666\n",
+		`umem_cache_fallback_duration_seconds_bucket{le="+Inf"} 1` + "\n",
+		"umem_cache_fallback_duration_seconds_count 1\n",
+		`umem_cache_operation_duration_seconds_count{op="get_or_set"} 3` + "\n",
+		"umem_cache_dial_failures_total 0\n",
+		`umem_cache_idle_conns{client="a\"b",member="` + server.Addr() + `",thread="1"} `,
+		`umem_cache_tickets_in_use{client="a\"b",member="` + server.Addr() + `",thread="0"} 0` + "\n",
+	}
+	for _, expect := range expects {
+		if !strings.Contains(text, expect) {
+			t.Errorf("missing %q in:\n%s", expect, text)
+		}
+	}
+	if strings.Contains(text, "umem_cache_cluster_version") {
+		t.Errorf("unexpected cluster gauges for a Client:\n%s", text)
+	}
+}
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+	"time"
+)
+
+type NearCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Size      int
+}
+
+type nearEntry struct {
+	key     string
+	val     []byte
+	expires time.Time
+}
+
+// nearCache is an in-process LRU in front of umem-cache, size counts keys
+// and values.
+type nearCache struct {
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+	// gen changes on every invalidation, a value fetched before that should
+	// not be kept.
+	gen   uint64
+	stats NearCacheStats
+}
+
+func newNearCache(size int, ttl time.Duration) *nearCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+
+	return &nearCache{
+		size:  size,
+		ttl:   ttl,
+		lru:   list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (near *nearCache) __remove(element *list.Element) {
+	e := near.lru.Remove(element).(*nearEntry)
+	delete(near.items, e.key)
+	near.stats.Entries--
+	near.stats.Size -= len(e.key) + len(e.val)
+}
+
+// get returns the value of key and current generation.
+func (near *nearCache) get(key []byte) ([]byte, uint64, bool) {
+	if near == nil {
+		return nil, 0, false
+	}
+
+	near.mu.Lock()
+	defer near.mu.Unlock()
+
+	element, ok := near.items[string(key)]
+	if ok {
+		e := element.Value.(*nearEntry)
+		if time.Now().Before(e.expires) {
+			near.lru.MoveToFront(element)
+			near.stats.Hits++
+			return bytes.Clone(e.val), near.gen, true
+		}
+		near.__remove(element)
+	}
+
+	near.stats.Misses++
+	return nil, near.gen, false
+}
+
+// set keeps val unless there is an invalidation since gen.
+func (near *nearCache) set(key []byte, val []byte, gen uint64) {
+	if near == nil || len(key)+len(val) > near.size {
+		return
+	}
+
+	near.mu.Lock()
+	defer near.mu.Unlock()
+
+	if gen != near.gen {
+		return
+	}
+
+	element, ok := near.items[string(key)]
+	if ok {
+		near.__remove(element)
+	}
+
+	for near.stats.Size+len(key)+len(val) > near.size {
+		near.__remove(near.lru.Back())
+		near.stats.Evictions++
+	}
+
+	e := &nearEntry{string(key), bytes.Clone(val), time.Now().Add(near.ttl)}
+	near.items[e.key] = near.lru.PushFront(e)
+	near.stats.Entries++
+	near.stats.Size += len(e.key) + len(e.val)
+}
+
+func (near *nearCache) del(key []byte) {
+	if near == nil {
+		return
+	}
+
+	near.mu.Lock()
+	defer near.mu.Unlock()
+
+	near.gen++
+	element, ok := near.items[string(key)]
+	if ok {
+		near.__remove(element)
+	}
+}
+
+func (near *nearCache) flush() {
+	if near == nil {
+		return
+	}
+
+	near.mu.Lock()
+	defer near.mu.Unlock()
+
+	near.gen++
+	near.lru.Init()
+	clear(near.items)
+	near.stats.Entries = 0
+	near.stats.Size = 0
+}
+
+func (near *nearCache) Stats() NearCacheStats {
+	if near == nil {
+		return NearCacheStats{}
+	}
+
+	near.mu.Lock()
+	defer near.mu.Unlock()
+
+	return near.stats
+}
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+type Operation byte
+
+const (
+	OpGetOrSet Operation = iota
+	OpDel
+	OpMultiGetOrSet
+)
+
+var operations = [...]string{
+	OpGetOrSet:      "get_or_set",
+	OpDel:           "del",
+	OpMultiGetOrSet: "multi_get_or_set",
+}
+
+func (op Operation) String() string {
+	if int(op) >= len(operations) {
+		return "invalid-operation"
+	}
+	return operations[op]
+}
+
+// OperationEvent is reported once for every key of an operation.
+type OperationEvent struct {
+	Op      Operation
+	KeySize int
+	ValSize int
+	// Hit is set if the value is got without calling the fallback.
+	Hit bool
+	// Uncached is set if the value is got from the fallback directly, in
+	// degraded mode or by Breaker.FailOpen.
+	Uncached bool
+	// Fallback is the time spent in the fallback.
+	Fallback time.Duration
+	Duration time.Duration
+	Err      error
+}
+
+// Observer is called synchronously from the operations, it should be fast
+// and safe for concurrent use. Embed NopObserver to implement part of it.
+type Observer interface {
+	OnOperation(e OperationEvent)
+	OnDial(address string, threadID uint32, duration time.Duration, err error)
+	// OnConnClose is called with the error that makes the connection
+	// useless, nil if the connection is closed with the client.
+	OnConnClose(address string, threadID uint32, err error)
+	// OnTicketWait is called for every ticket acquired by a request, with 0
+	// wait if it is available at once.
+	OnTicketWait(address string, threadID uint32, wait time.Duration, err error)
+	OnRetry(attempt int, err error)
+	// OnClusterRebuild is called if a rebuild fails, or changes the cluster
+	// or the leader.
+	OnClusterRebuild(cluster proto.Cluster, leader string, err error)
+}
+
+type NopObserver struct{}
+
+func (NopObserver) OnOperation(e OperationEvent) {}
+
+func (NopObserver) OnDial(address string, threadID uint32, duration time.Duration, err error) {}
+
+func (NopObserver) OnConnClose(address string, threadID uint32, err error) {}
+
+func (NopObserver) OnTicketWait(address string, threadID uint32, wait time.Duration, err error) {}
+
+func (NopObserver) OnRetry(attempt int, err error) {}
+
+func (NopObserver) OnClusterRebuild(cluster proto.Cluster, leader string, err error) {}
+
+// fallbackObserver learns whether and how long the fallback is called.
+type fallbackObserver struct {
+	start    time.Time
+	called   bool
+	fallback time.Duration
+}
+
+func (o *fallbackObserver) wrap(get proto.FallbackGetFunc) proto.FallbackGetFunc {
+	if get == nil {
+		return nil
+	}
+
+	return func(key []byte) ([]byte, error) {
+		o.called = true
+		start := time.Now()
+		val, err := get(key)
+		o.fallback += time.Since(start)
+		return val, err
+	}
+}
+
+func (o *fallbackObserver) wrapBatch(get BatchFallbackGetFunc, missed map[string]struct{}) BatchFallbackGetFunc {
+	if get == nil {
+		return nil
+	}
+
+	var mu sync.Mutex
+	return func(keys [][]byte) ([][]byte, error) {
+		start := time.Now()
+		vals, err := get(keys)
+		d := time.Since(start)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, key := range keys {
+			missed[string(key)] = struct{}{}
+		}
+		o.fallback += d
+		return vals, err
+	}
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// keeper closes expired idle connections of threads and keeps
+// Config.MinIdleConnsPerThread idle connections in background.
+type keeper struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// keepInterval returns 0 if there is nothing to keep.
+func keepInterval(conf Config) time.Duration {
+	var interval time.Duration
+	for _, d := range []time.Duration{conf.IdleConnTimeout / 2, conf.MaxConnLifetime / 2} {
+		if d > 0 && (interval == 0 || d < interval) {
+			interval = d
+		}
+	}
+
+	if interval == 0 && conf.MinIdleConnsPerThread == 0 {
+		return 0
+	}
+	if interval == 0 || interval > time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// startKeeper returns nil if there is nothing to keep.
+func startKeeper(threads []thread, conf Config) *keeper {
+	interval := keepInterval(conf)
+	if interval == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	k := &keeper{cancel: cancel, done: make(chan struct{})}
+	go k.run(ctx, threads, interval, conf.Timeout)
+	return k
+}
+
+func (k *keeper) run(ctx context.Context, threads []thread, interval time.Duration, timeout time.Duration) {
+	defer close(k.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		for i := range threads {
+			threads[i].sweep(now)
+		}
+		fill(ctx, now.Add(timeout), threads)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop waits for the keeper to return, k can be nil.
+func (k *keeper) Stop() {
+	if k != nil {
+		k.cancel()
+		<-k.done
+	}
+}
+
+// fill dials idle connections of all threads concurrently.
+func fill(ctx context.Context, deadline time.Time, groups ...[]thread) {
+	var wg sync.WaitGroup
+	for _, threads := range groups {
+		for i := range threads {
+			t := &threads[i]
+			if t.minIdle == 0 {
+				continue
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				t.fill(ctx, deadline)
+			}()
+		}
+	}
+	wg.Wait()
+}
@@ -23,14 +23,39 @@ func ResolveAddresses(addresses []string) ([]*net.TCPAddr, error) {
 	addr := make([]*net.TCPAddr, len(addresses))
 	for i := range addresses {
 		var err error
-		addr[i], err = net.ResolveTCPAddr("tcp6", addresses[i])
+		addr[i], err = net.ResolveTCPAddr("tcp", addresses[i])
 		if err != nil {
-			return nil, fmt.Errorf("resolve tcp6 address: %s failed: %w", addresses[i], err)
+			return nil, fmt.Errorf("resolve tcp address: %s failed: %w", addresses[i], err)
 		}
 	}
 	return addr, nil
 }
 
+// AddrEqual treats an IPv4 address and its IPv4-mapped IPv6 form as equal.
 func AddrEqual(a, b *net.TCPAddr) bool {
-	return a.Port == b.Port && a.IP.Equal(b.IP)
+	return a.Port == b.Port && wireIP(a.IP).Equal(wireIP(b.IP))
+}
+
+// wireIP returns ip in the 16-byte wire form, IPv4 is IPv4-mapped, and nil
+// is the unspecified address.
+func wireIP(ip net.IP) net.IP {
+	if ip16 := ip.To16(); ip16 != nil {
+		return ip16
+	}
+	return net.IPv6unspecified
+}
+
+// appendIP appends ip in the 16-byte wire form.
+func appendIP(dest []byte, ip net.IP) []byte {
+	return append(dest, wireIP(ip)...)
+}
+
+// newIP returns an IPv4-mapped address of the wire form as IPv4.
+func newIP(bin []byte) net.IP {
+	ip := make(net.IP, 16)
+	copy(ip, bin)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
 }
@@ -13,8 +13,13 @@ type AuthorityConn struct {
 	conn *Conn
 }
 
+// DialAuthority dials by a net.Dialer, with TLS if config is not nil.
 func DialAuthority(deadline time.Time, address string, config *tls.Config) (*AuthorityConn, error) {
-	c, err := Dial(deadline, address, config)
+	return DialAuthorityWithDialer(deadline, address, Dialer{TLSConfig: config})
+}
+
+func DialAuthorityWithDialer(deadline time.Time, address string, dialer Dialer) (*AuthorityConn, error) {
+	c, err := DialWithDialer(deadline, address, dialer)
 	if err != nil {
 		return nil, err
 	}
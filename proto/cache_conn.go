@@ -5,17 +5,22 @@ package proto
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"net"
+	"slices"
 	"time"
 )
 
 type FallbackGetFunc func(key []byte) (val []byte, err error)
 
+type FallbackGetContextFunc func(ctx context.Context, key []byte) (val []byte, err error)
+
 var (
 	ErrClientSide  = errors.New("client side error")
 	ErrBadKeySize  = fmt.Errorf("%w: key size out of limit", ErrClientSide)
@@ -32,37 +37,74 @@ const (
 type CacheConn struct {
 	writer *bufio.Writer
 	conn   *Conn
+	// buf is for requests and response headers, so that a hit makes no
+	// allocation.
+	buf    [2 + math.MaxUint8]byte
+	dialed time.Time
 }
 
+// DialCache dials by a net.Dialer, with TLS if config is not nil.
 func DialCache(deadline time.Time, address string, threadID uint32, config *tls.Config) (*CacheConn, error) {
-	conn, err := Dial(deadline, address, config)
+	return DialCacheWithDialer(deadline, address, threadID, Dialer{TLSConfig: config})
+}
+
+func DialCacheContext(ctx context.Context, address string, threadID uint32, config *tls.Config) (*CacheConn, error) {
+	return DialCacheContextWithDialer(ctx, address, threadID, Dialer{TLSConfig: config})
+}
+
+func DialCacheWithDialer(deadline time.Time, address string, threadID uint32, dialer Dialer) (*CacheConn, error) {
+	ctx, cancel := deadlineContext(deadline)
+	defer cancel()
+
+	return DialCacheContextWithDialer(ctx, address, threadID, dialer)
+}
+
+func DialCacheContextWithDialer(ctx context.Context, address string, threadID uint32, dialer Dialer) (*CacheConn, error) {
+	conn, err := DialContextWithDialer(ctx, address, dialer)
 	if err != nil {
 		return nil, fmt.Errorf("dial failed: %w", err)
 	}
 
+	deadline, _ := ctx.Deadline()
 	err = conn.SetDeadline(deadline)
 	if err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("set deadline failed: %w", err)
 	}
 
+	stop := conn.watch(ctx)
 	err = conn.connect(threadID)
+	if !stop() {
+		conn.Close()
+		return nil, fmt.Errorf("connect thread failed: %w", ctx.Err())
+	}
 	if err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("connect thread failed: %w", err)
 	}
 
-	if config == nil {
-		return &CacheConn{nil, conn}, nil
+	if dialer.TLSConfig == nil {
+		return &CacheConn{conn: conn, dialed: time.Now()}, nil
 	}
 
-	return &CacheConn{bufio.NewWriterSize(conn.v, DEFAULT_BUFFER_SIZE), conn}, nil
+	return &CacheConn{writer: bufio.NewWriterSize(conn.v, DEFAULT_BUFFER_SIZE), conn: conn, dialed: time.Now()}, nil
 }
 
 func (c *CacheConn) SetDeadline(deadline time.Time) error {
 	return c.conn.SetDeadline(deadline)
 }
 
+// Dialed returns the time the connection is established.
+func (c *CacheConn) Dialed() time.Time {
+	return c.dialed
+}
+
+// Watch interrupts the in-flight request once ctx is done, stop returns false
+// if the interruption has happened, and the connection should be closed.
+func (c *CacheConn) Watch(ctx context.Context) (stop func() bool) {
+	return c.conn.watch(ctx)
+}
+
 func (c *CacheConn) read(buff []byte) error {
 	return c.conn.read(buff)
 }
@@ -90,37 +132,174 @@ func (c *CacheConn) writeCMD(cmd _CMD, key []byte) error {
 		return ErrBadKeySize
 	}
 
-	return c.writev(net.Buffers{{byte(cmd), byte(len(key))}, key})
+	c.buf[0] = byte(cmd)
+	c.buf[1] = byte(len(key))
+	n := 2 + copy(c.buf[2:], key)
+	if c.writer == nil {
+		return c.conn.write(c.buf[:n])
+	}
+
+	_, err := c.writer.Write(c.buf[:n])
+	if err == nil {
+		err = c.writer.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("buffer write failed: %w", err)
+	}
+	return nil
 }
 
-func (c *CacheConn) get(key []byte) ([]byte, error) {
+// getAppend appends the value to dst on a hit.
+func (c *CacheConn) getAppend(dst []byte, key []byte) ([]byte, bool, error) {
 	if err := c.writeCMD(_CMD_GET_OR_SET, key); err != nil {
-		return nil, fmt.Errorf("write cmd failed: %w", err)
+		return dst, false, fmt.Errorf("write cmd failed: %w", err)
 	}
 
-	res := make([]byte, 8+1)
+	res := c.buf[:8+1]
 	if err := c.read(res); err != nil {
-		return nil, fmt.Errorf("read cmd response failed: %w", err)
+		return dst, false, fmt.Errorf("read cmd response failed: %w", err)
 	}
 
 	if res[8] == 1 {
-		return nil, nil
+		return dst, false, nil
 	}
 
 	size := binary.LittleEndian.Uint64(res)
-	val := make([]byte, size)
-	if err := c.read(val); err != nil {
-		return nil, fmt.Errorf("read value failed: %w", err)
+	if dst == nil {
+		dst = make([]byte, 0, size)
+	}
+	n := len(dst)
+	dst = slices.Grow(dst, int(size))[:n+int(size)]
+	if err := c.read(dst[n:]); err != nil {
+		return dst[:n], false, fmt.Errorf("read value failed: %w", err)
+	}
+	return dst, true, nil
+}
+
+func (c *CacheConn) get(key []byte) ([]byte, error) {
+	val, hit, err := c.getAppend(nil, key)
+	if !hit {
+		return nil, err
 	}
 	return val, nil
 }
 
 func (c *CacheConn) set(val []byte) error {
-	size := make([]byte, 8)
+	size := c.buf[:8]
 	binary.LittleEndian.PutUint64(size, uint64(len(val)))
 	return c.writev(net.Buffers{size, val})
 }
 
+// Get returns nil on a miss, then the connection holds the populate lock of
+// key, the caller should Set the value or Close the connection.
+func (c *CacheConn) Get(key []byte) ([]byte, error) {
+	val, err := c.get(key)
+	if err != nil {
+		return nil, fmt.Errorf("get failed: %w", err)
+	}
+	return val, nil
+}
+
+// GetAppend is like Get, but appends the value to dst on a hit, and makes
+// no allocation if dst has room for the value.
+func (c *CacheConn) GetAppend(dst []byte, key []byte) (val []byte, hit bool, err error) {
+	val, hit, err = c.getAppend(dst, key)
+	if err != nil {
+		return val, false, fmt.Errorf("get failed: %w", err)
+	}
+	return val, hit, nil
+}
+
+func (c *CacheConn) Set(val []byte) error {
+	if err := c.set(val); err != nil {
+		return fmt.Errorf("set failed: %w", err)
+	}
+	return nil
+}
+
+// GetStream is like Get, but the value of size is read from r, it should be
+// read out before the next request. r is nil on a miss, then the caller
+// should SetStream or Close the connection.
+func (c *CacheConn) GetStream(key []byte) (r io.Reader, size int64, err error) {
+	if err := c.writeCMD(_CMD_GET_OR_SET, key); err != nil {
+		return nil, 0, fmt.Errorf("get failed: write cmd failed: %w", err)
+	}
+
+	res := c.buf[:8+1]
+	if err := c.read(res); err != nil {
+		return nil, 0, fmt.Errorf("get failed: read cmd response failed: %w", err)
+	}
+
+	if res[8] == 1 {
+		return nil, 0, nil
+	}
+
+	size = int64(binary.LittleEndian.Uint64(res))
+	return io.LimitReader(c.conn.reader, size), size, nil
+}
+
+// ValueWriter writes a value of the size given to SetStream, the value is
+// set once size bytes are written.
+type ValueWriter struct {
+	c    *CacheConn
+	left int64
+}
+
+var errValueOverflow = fmt.Errorf("%w: value overflow", ErrClientSide)
+
+func (w *ValueWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > w.left {
+		return 0, errValueOverflow
+	}
+
+	var n int
+	var err error
+	if w.c.writer == nil {
+		n, err = w.c.conn.v.Write(p)
+	} else {
+		n, err = w.c.writer.Write(p)
+	}
+	w.left -= int64(n)
+	if err == nil && w.left == 0 {
+		err = w.flush()
+	}
+	if err != nil {
+		return n, fmt.Errorf("set failed: %w", err)
+	}
+	return n, nil
+}
+
+func (w *ValueWriter) flush() error {
+	if w.c.writer == nil {
+		return nil
+	}
+	return w.c.writer.Flush()
+}
+
+// SetStream is like Set, but the value of size is written to w.
+func (c *CacheConn) SetStream(size int64) (*ValueWriter, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("%w: bad value size: %d", ErrClientSide, size)
+	}
+
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint64(header, uint64(size))
+	w := &ValueWriter{c, size}
+	var err error
+	if c.writer == nil {
+		err = c.conn.write(header)
+	} else {
+		_, err = c.writer.Write(header)
+		if err == nil && size == 0 {
+			err = w.flush()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("set failed: %w", err)
+	}
+	return w, nil
+}
+
 func (c *CacheConn) GetOrSet(key []byte, get FallbackGetFunc) ([]byte, error) {
 	val, err := c.get(key)
 	if err != nil {
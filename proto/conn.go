@@ -5,6 +5,7 @@ package proto
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"encoding/binary"
 	"errors"
@@ -16,6 +17,8 @@ import (
 
 const DEFAULT_BUFFER_SIZE = 16 << 10
 
+var aLongTimeAgo = time.Unix(1, 0)
+
 type raftCommand byte
 
 const (
@@ -65,17 +68,82 @@ func (c *Conn) communicate(req []byte, res []byte) error {
 	return nil
 }
 
+// deadlineContext returns a context done at deadline, zero deadline for no
+// limit.
+func deadlineContext(deadline time.Time) (context.Context, context.CancelFunc) {
+	if deadline.IsZero() {
+		return context.Background(), func() {}
+	}
+	return context.WithDeadline(context.Background(), deadline)
+}
+
+// DialFunc dials the connection that TLS, if any, is layered on, network is
+// always "tcp" and address is a TCP address. It can be replaced to dial e.g.
+// through a proxy, or an in-memory pipe.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// Dialer is the zero value for dialing by a net.Dialer without TLS.
+type Dialer struct {
+	DialContext DialFunc // nil for a net.Dialer
+	TLSConfig   *tls.Config
+}
+
+func (d Dialer) dial(ctx context.Context, address string) (net.Conn, error) {
+	if d.DialContext == nil {
+		var tcpDialer net.Dialer
+		if d.TLSConfig == nil {
+			return tcpDialer.DialContext(ctx, "tcp", address)
+		}
+		dialer := tls.Dialer{Config: d.TLSConfig, NetDialer: &tcpDialer}
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+
+	c, err := d.DialContext(ctx, "tcp", address)
+	if err != nil || d.TLSConfig == nil {
+		return c, err
+	}
+
+	config := d.TLSConfig
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	tc := tls.Client(c, config)
+	err = tc.HandshakeContext(ctx)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// Dial dials by a net.Dialer, with TLS if config is not nil.
 func Dial(deadline time.Time, address string, config *tls.Config) (*Conn, error) {
-	var c net.Conn
-	var err error
-	tcpDialer := net.Dialer{Deadline: deadline}
-	if config == nil {
-		c, err = tcpDialer.Dial("tcp6", address)
-	} else {
-		dialer := tls.Dialer{Config: config, NetDialer: &tcpDialer}
-		c, err = dialer.Dial("tcp6", address)
+	return DialWithDialer(deadline, address, Dialer{TLSConfig: config})
+}
+
+func DialContext(ctx context.Context, address string, config *tls.Config) (*Conn, error) {
+	return DialContextWithDialer(ctx, address, Dialer{TLSConfig: config})
+}
+
+func DialWithDialer(deadline time.Time, address string, dialer Dialer) (*Conn, error) {
+	ctx, cancel := deadlineContext(deadline)
+	defer cancel()
+
+	return DialContextWithDialer(ctx, address, dialer)
+}
+
+func DialContextWithDialer(ctx context.Context, address string, dialer Dialer) (*Conn, error) {
+	c, err := dialer.dial(ctx, address)
+	if err != nil {
+		return nil, err
 	}
-	return &Conn{c, bufio.NewReaderSize(c, DEFAULT_BUFFER_SIZE)}, err
+	return &Conn{c, bufio.NewReaderSize(c, DEFAULT_BUFFER_SIZE)}, nil
 }
 
 func (c *Conn) SetDeadline(deadline time.Time) error {
@@ -94,6 +162,22 @@ func (c *Conn) Close() {
 	c.v.Close()
 }
 
+func usable() bool {
+	return true
+}
+
+// watch interrupts the in-flight I/O once ctx is done, stop returns false if
+// the interruption has happened, and the connection should not be reused.
+func (c *Conn) watch(ctx context.Context) (stop func() bool) {
+	if ctx.Done() == nil {
+		return usable
+	}
+
+	return context.AfterFunc(ctx, func() {
+		c.v.SetDeadline(aLongTimeAgo)
+	})
+}
+
 func (c *Conn) connect(threadID uint32) error {
 	req := make([]byte, 4+4)
 	req[0] = byte(_CMD_CONNECT)
@@ -139,8 +223,7 @@ func (c *Conn) Leader() (string, error) {
 	}
 
 	addr := new(net.TCPAddr)
-	addr.IP = make([]byte, 16)
-	copy(addr.IP, res)
+	addr.IP = newIP(res)
 	addr.Port = int(binary.BigEndian.Uint16(res[16:]))
 	return addr.String(), nil
 }
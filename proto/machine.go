@@ -26,7 +26,7 @@ func (m *Machine) Match(addr *net.TCPAddr) bool {
 }
 
 func (m *Machine) append(dest []byte) []byte {
-	dest = append(dest, m.Addr.IP...)
+	dest = appendIP(dest, m.Addr.IP)
 	dest = binary.BigEndian.AppendUint16(dest, uint16(m.Addr.Port))
 	dest = append(dest, 0, 0)
 	dest = binary.LittleEndian.AppendUint32(dest, m.ID)
@@ -36,8 +36,7 @@ func (m *Machine) append(dest []byte) []byte {
 
 func newMachine(bin []byte) Machine {
 	addr := new(net.TCPAddr)
-	addr.IP = make([]byte, 16)
-	copy(addr.IP, bin)
+	addr.IP = newIP(bin)
 	addr.Port = int(binary.BigEndian.Uint16(bin[16:]))
 	return Machine{
 		addr,
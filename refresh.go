@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+// maxRefreshBackoff limits the backoff of failed polls, in intervals.
+const maxRefreshBackoff = 16
+
+// refresher polls the cluster in background, so that Cluster is rebuilt
+// before operations fail on a change.
+type refresher struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startRefresher returns nil if Config.RefreshInterval is 0.
+func (c *Cluster) startRefresher() *refresher {
+	interval := c.config.RefreshInterval
+	if interval == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &refresher{cancel: cancel, done: make(chan struct{})}
+	go c.runRefresher(ctx, r.done, interval)
+	return r
+}
+
+func (c *Cluster) runRefresher(ctx context.Context, done chan struct{}, interval time.Duration) {
+	defer close(done)
+
+	backoff := RetryPolicy{
+		InitialBackoff: interval,
+		Multiplier:     2,
+		MaxBackoff:     maxRefreshBackoff * interval,
+	}
+	for failures := 0; ; {
+		// the jitter keeps clients started together from polling in lockstep
+		d := backoff.backoff(failures + 1)
+		timer := time.NewTimer(d/2 + rand.N(d))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		err := c.refresh()
+		if err == nil {
+			failures = 0
+			continue
+		}
+		failures++
+		c.config.Logger.Warn("refresh cluster failed", "failures", failures, "error", err)
+	}
+}
+
+// refresh polls the cluster once, and rebuilds c if the version or the
+// leader changed. The rebuild is skipped if c is rebuilding already. If only
+// the machines changed, they are updated without a rebuild, so that
+// operations in flight are not disturbed.
+func (c *Cluster) refresh() error {
+	c.mu.RLock()
+	version, leader := c.version, c.leader
+	addrs := c.__addresses()
+	c.mu.RUnlock()
+
+	// the refresher backs off by itself
+	admin := AdminConfig{Dialer: c.config.Dialer(), Retry: RetryPolicy{MaxAttempts: 1}}
+	newLeader, cluster, err := AdminLeaderClusterWithConfig(c.deadline(), addrs, admin)
+	if err != nil {
+		return err
+	}
+
+	if cluster.Version != version || newLeader != leader {
+		c.rebuild(version)
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the rebuild since the poll takes the change
+	if c.closed || c.updating || c.version != version || c.leader != leader {
+		return nil
+	}
+
+	e := TopologyEvent{
+		Old:       proto.Cluster{Type: c._type, Version: c.version, Machines: c.machines},
+		New:       cluster,
+		OldLeader: leader,
+		NewLeader: leader,
+	}
+	if !e.changed() {
+		return nil
+	}
+
+	if cluster.Type != c._type {
+		c.config.Logger.Info("cluster type changed", logVersion, version,
+			"old_type", c._type.String(), logType, cluster.Type.String())
+		c._type = cluster.Type
+	}
+	if !machinesEqual(cluster.Machines, c.machines) {
+		c.config.Logger.Debug("cluster machines changed", logLeader, leader, logVersion, version)
+		c.machines = cluster.Machines
+	}
+	c.watchers.notify(e)
+	return nil
+}
+
+// Stop waits for the refresher to return, r can be nil.
+func (r *refresher) Stop() {
+	if r != nil {
+		r.cancel()
+		<-r.done
+	}
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+const defaultBackoff = 100 * time.Millisecond
+
+// RetryPolicy decides whether and when a failed attempt of a Cluster
+// operation or an admin helper is retried. The zero value retries every
+// 100ms until the deadline.
+type RetryPolicy struct {
+	InitialBackoff time.Duration // 0 for 100ms
+	Multiplier     float64       // less than 1 for 1
+	MaxBackoff     time.Duration // 0 for no limit
+	// Jitter sleeps a random duration up to the backoff, so that clients
+	// failed at the same time do not retry in lockstep.
+	Jitter      bool
+	MaxAttempts int // 0 for no limit
+	// Retryable reports whether err is worth retrying, nil for
+	// DefaultRetryable.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryable retries errors except timeouts, cancellations, client
+// side errors, open circuits and errors of a closed cluster.
+func DefaultRetryable(err error) bool {
+	return !errIsIOTimeout(err) && !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, proto.ErrClientSide) && !errors.Is(err, ErrCircuitOpen) &&
+		!errors.Is(err, errClosed)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable == nil {
+		return DefaultRetryable(err)
+	}
+	return p.Retryable(err)
+}
+
+// retry reports whether to retry after attempt failed with err.
+func (p *RetryPolicy) retry(attempt int, err error) bool {
+	return p.retryable(err) && (p.MaxAttempts <= 0 || attempt < p.MaxAttempts)
+}
+
+// backoff returns the sleep duration after attempt, attempt starts from 1.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	if d <= 0 {
+		d = defaultBackoff
+	}
+
+	for i := 1; i < attempt && p.Multiplier > 1 && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		next := float64(d) * p.Multiplier
+		if next >= math.MaxInt64 {
+			d = math.MaxInt64
+			break
+		}
+		d = time.Duration(next)
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	if p.Jitter {
+		d = rand.N(d)
+	}
+	return d
+}
+
+// sleep returns early if ctx is done.
+func (p *RetryPolicy) sleep(ctx context.Context, attempt int) {
+	timer := time.NewTimer(p.backoff(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// sleepDeadline returns early at deadline, zero deadline for no limit.
+func (p *RetryPolicy) sleepDeadline(deadline time.Time, attempt int) {
+	d := p.backoff(attempt)
+	if !deadline.IsZero() {
+		d = min(d, time.Until(deadline))
+	}
+	time.Sleep(d)
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	var zero RetryPolicy
+	for attempt := 1; attempt < 4; attempt++ {
+		if d := zero.backoff(attempt); d != defaultBackoff {
+			t.Fatalf("want backoff: %v, got: %v", defaultBackoff, d)
+		}
+	}
+
+	p := RetryPolicy{
+		InitialBackoff: 10 * time.Millisecond,
+		Multiplier:     2,
+		MaxBackoff:     50 * time.Millisecond,
+	}
+	wants := []time.Duration{10, 20, 40, 50, 50}
+	for i, want := range wants {
+		if d := p.backoff(i + 1); d != want*time.Millisecond {
+			t.Fatalf("attempt %d want backoff: %v, got: %v", i+1, want*time.Millisecond, d)
+		}
+	}
+
+	p.MaxBackoff = 0
+	if d := p.backoff(1000); d != time.Duration(1<<63-1) {
+		t.Fatalf("want overflowed backoff capped, got: %v", d)
+	}
+
+	p.MaxBackoff = 50 * time.Millisecond
+	p.Jitter = true
+	for range 100 {
+		if d := p.backoff(10); d < 0 || d >= p.MaxBackoff {
+			t.Fatalf("jittered backoff out of range: %v", d)
+		}
+	}
+}
+
+func TestRetryPolicyRetry(t *testing.T) {
+	retryable := errors.New("retryable")
+	notRetryable := []error{
+		os.ErrDeadlineExceeded,
+		context.DeadlineExceeded,
+		fmt.Errorf("wrapped: %w", context.Canceled),
+		proto.ErrBadKeySize,
+		errClosed,
+	}
+
+	var zero RetryPolicy
+	if !zero.retry(1000, retryable) {
+		t.Fatal("want retry without attempt limit")
+	}
+	for _, err := range notRetryable {
+		if zero.retry(1, err) {
+			t.Fatalf("want no retry on: %v", err)
+		}
+	}
+
+	p := RetryPolicy{MaxAttempts: 3}
+	if !p.retry(2, retryable) || p.retry(3, retryable) {
+		t.Fatal("want at most 3 attempts")
+	}
+
+	p.Retryable = func(err error) bool {
+		return errors.Is(err, os.ErrDeadlineExceeded)
+	}
+	if !p.retry(1, os.ErrDeadlineExceeded) || p.retry(1, retryable) {
+		t.Fatal("want custom classification")
+	}
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+// ThreadStats counters are cumulative since the Client or Cluster is built,
+// counters of a Cluster member are kept by its address across rebuilds.
+type ThreadStats struct {
+	IdleConns    int
+	TicketsInUse int
+	MaxConns     int // 0 for no limit
+
+	Dials        uint64
+	DialFailures uint64
+	// ErrorCloses counts connections closed because of errors, including
+	// fallback failures and canceled requests.
+	ErrorCloses uint64
+	// Tickets counts the tickets acquired by requests.
+	Tickets uint64
+	// TicketWait is the total wait of Tickets acquired by requests.
+	TicketWait time.Duration
+}
+
+type MemberStats struct {
+	Address string
+	Threads []ThreadStats
+	Breaker BreakerStats // for Cluster only
+}
+
+type Stats struct {
+	Members []MemberStats
+
+	// for Cluster only
+	Version        uint64
+	Type           proto.ClusterType
+	Leader         string
+	AuthorityQueue int
+	// QueuedDels are the keys whose Del is waiting for replay in degraded
+	// mode.
+	QueuedDels int
+
+	NearCache NearCacheStats
+}
+
+func (t *thread) stats() ThreadStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return ThreadStats{
+		IdleConns:    len(t.idleConns),
+		TicketsInUse: len(t.tickets),
+		MaxConns:     cap(t.tickets),
+		Dials:        t.dials.Load(),
+		DialFailures: t.dialFailures.Load(),
+		ErrorCloses:  t.errorCloses.Load(),
+		Tickets:      t.ticketsAcquired.Load(),
+		TicketWait:   time.Duration(t.ticketWait.Load()),
+	}
+}
+
+func threadsStats(threads []thread) []ThreadStats {
+	stats := make([]ThreadStats, len(threads))
+	for i := range threads {
+		stats[i] = threads[i].stats()
+	}
+	return stats
+}
+
+func (auth *authority) queueLen() int {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	if auth.__closed() {
+		return 0
+	}
+	return auth.requests.Len()
+}
+
+func (c *Client) Stats() Stats {
+	return Stats{
+		Members: []MemberStats{{
+			Address: c.threads[0].route,
+			Threads: threadsStats(c.threads),
+		}},
+		NearCache: c.near.Stats(),
+	}
+}
+
+func (c *Cluster) Stats() Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := Stats{
+		Members:        make([]MemberStats, len(c.members)),
+		Version:        c.version,
+		Type:           c._type,
+		Leader:         c.leader,
+		AuthorityQueue: c.authority.queueLen(),
+		QueuedDels:     c.degraded.queued(),
+		NearCache:      c.near.Stats(),
+	}
+	for i := range c.members {
+		stats.Members[i] = MemberStats{
+			Address: c.members[i].address,
+			Threads: threadsStats(c.members[i].threads),
+			Breaker: c.members[i].breaker.stats(),
+		}
+	}
+	return stats
+}
@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+// StreamFallbackGetFunc returns the value of key as size bytes read from r,
+// r is closed with the stream if it is an io.Closer.
+type StreamFallbackGetFunc func(ctx context.Context, key []byte) (r io.Reader, size int64, err error)
+
+var errStreamClosed = errors.New("stream is closed before the value is read out")
+
+// stream reads a value from the connection on a hit, or from the fallback
+// on a miss while the value is set to the connection. The connection and
+// its ticket are held until the value is read out or the stream is closed.
+type stream struct {
+	t       *thread
+	conn    *proto.CacheConn
+	ctx     context.Context
+	stop    func() bool
+	timeout time.Duration
+	r       io.Reader
+	left    int64
+	src     io.Reader // of the fallback, nil for a hit
+	err     error     // for finished
+	key     []byte
+	// approved reports whether the value set on a miss is kept, it is
+	// deleted otherwise, nil for always
+	approved func() bool
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	if s.conn == nil {
+		return 0, s.err
+	}
+	if s.left == 0 {
+		s.finish(nil)
+		return 0, io.EOF
+	}
+
+	// the interruption by ctx happens after the deadline is set, or is
+	// found here
+	err := s.conn.SetDeadline(time.Now().Add(s.timeout))
+	if err == nil {
+		err = s.ctx.Err()
+	}
+	if err != nil {
+		s.finish(err)
+		return 0, err
+	}
+
+	if int64(len(p)) > s.left {
+		p = p[:s.left]
+	}
+	n, err := s.r.Read(p)
+	s.left -= int64(n)
+	if s.left == 0 {
+		s.finish(nil)
+		return n, nil
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		err = errOr(s.ctx.Err(), err)
+		s.finish(err)
+		return n, err
+	}
+	return n, nil
+}
+
+// Close returns the connection if the value is read out, or closes it.
+func (s *stream) Close() error {
+	if s.conn != nil {
+		s.finish(errStreamClosed)
+	}
+	return nil
+}
+
+func (s *stream) finish(err error) {
+	closeErr := err
+	stopped := s.stop()
+	if stopped && err == nil && s.src != nil && s.approved != nil && !s.approved() {
+		closeErr = s.del()
+	}
+	if stopped && closeErr == nil {
+		s.t._return(s.conn)
+	} else {
+		s.t.closeConn(s.conn, errOr(closeErr, s.ctx.Err()))
+	}
+	s.t.releaseTicket()
+	if c, ok := s.src.(io.Closer); ok {
+		c.Close()
+	}
+
+	s.conn = nil
+	s.err = err
+	if err == nil {
+		s.err = io.EOF
+	}
+}
+
+func (s *stream) del() error {
+	err := s.conn.SetDeadline(time.Now().Add(s.timeout))
+	if err != nil {
+		return err
+	}
+	err = s.conn.Del(s.key)
+	if err != nil {
+		return fmt.Errorf("del the value set failed: %w", err)
+	}
+	return nil
+}
+
+// __getOrSetStream takes the ticket on success.
+func (t *thread) __getOrSetStream(ctx context.Context, conn *proto.CacheConn, timeout time.Duration, key []byte, get StreamFallbackGetFunc, called *bool) (*stream, error) {
+	stop := conn.Watch(ctx)
+	fail := func(err error) (*stream, error) {
+		stop()
+		t.closeConn(conn, errOr(err, ctx.Err()))
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%w: %w", ctx.Err(), err)
+		}
+		return nil, err
+	}
+
+	r, size, err := conn.GetStream(key)
+	if err != nil {
+		return fail(err)
+	}
+	s := &stream{t: t, conn: conn, ctx: ctx, stop: stop, timeout: timeout, r: r, left: size, key: key}
+	if r != nil {
+		return s, nil
+	}
+
+	if get == nil {
+		return fail(fmt.Errorf("%w: nil", proto.ErrFallbackGet))
+	}
+	*called = true
+	s.src, s.left, err = get(ctx, key)
+	if err != nil {
+		return fail(fmt.Errorf("%w: %w", proto.ErrFallbackGet, err))
+	}
+
+	w, err := conn.SetStream(s.left)
+	if err != nil {
+		if c, ok := s.src.(io.Closer); ok {
+			c.Close()
+		}
+		return fail(err)
+	}
+	s.r = io.TeeReader(s.src, w)
+	return s, nil
+}
+
+func (t *thread) GetOrSetStream(ctx context.Context, deadline time.Time, timeout time.Duration, key []byte, get StreamFallbackGetFunc) (*stream, error) {
+	err := t.acquireTicket(ctx, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := t.getOrSetStream(ctx, deadline, timeout, key, get)
+	if err != nil {
+		t.releaseTicket()
+	}
+	return s, err
+}
+
+func (t *thread) getOrSetStream(ctx context.Context, deadline time.Time, timeout time.Duration, key []byte, get StreamFallbackGetFunc) (*stream, error) {
+	conn, err := t.dispatch(deadline)
+	if err != nil {
+		return nil, fmt.Errorf("dispatch failed: %w", err)
+	}
+
+	// the reader of the fallback can not be read twice
+	var called bool
+	if conn != nil {
+		s, err := t.__getOrSetStream(ctx, conn, timeout, key, get, &called)
+		if err == nil || called || ctx.Err() != nil {
+			return s, err
+		}
+	}
+
+	conn, err = t.dial(ctx, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.__getOrSetStream(ctx, conn, timeout, key, get, &called)
+}
@@ -5,38 +5,70 @@ package client
 
 import (
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/imchuncai/umem-cache-client-Go/proto"
 )
 
 type thread struct {
-	route   string
-	id      uint32
-	config  *tls.Config
-	tickets chan struct{} // nil for no limit
+	route    string
+	id       uint32
+	dialer   proto.Dialer
+	observer Observer
+	logger   *slog.Logger
+	tickets  chan struct{} // nil for no limit
+
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+	minIdle     int
 
 	mu        sync.Mutex
-	idleConns []*proto.CacheConn // nil for closed
+	idleConns []idleConn // nil for closed
+
+	*threadCounters
+}
+
+// threadCounters are kept apart from the thread, so that a Cluster keeps them
+// across rebuilds.
+type threadCounters struct {
+	dials           atomic.Uint64
+	dialFailures    atomic.Uint64
+	errorCloses     atomic.Uint64
+	ticketsAcquired atomic.Uint64
+	ticketWait      atomic.Int64
+}
+
+type idleConn struct {
+	*proto.CacheConn
+	since time.Time
 }
 
-func newThreads(route string, config Config) []thread {
+// newThreads takes a counter for each thread from counters.
+func newThreads(route string, config Config, counters []threadCounters) []thread {
 	threads := make([]thread, config.ThreadNR)
 	for i := range threads {
-		threads[i].init(route, uint32(i), config)
+		threads[i].init(route, uint32(i), config, &counters[i])
 	}
 	return threads
 }
 
-func (t *thread) init(route string, id uint32, config Config) {
+func (t *thread) init(route string, id uint32, config Config, counters *threadCounters) {
 	t.route = route
 	t.id = id
-	t.config = config.TLSConfig
-	t.idleConns = make([]*proto.CacheConn, 0, config.MaxConnsPerThread)
+	t.threadCounters = counters
+	t.dialer = config.Dialer()
+	t.observer = config.Observer
+	t.logger = config.Logger
+	t.idleTimeout = config.IdleConnTimeout
+	t.maxLifetime = config.MaxConnLifetime
+	t.minIdle = config.MinIdleConnsPerThread
+	t.idleConns = make([]idleConn, 0, config.MaxConnsPerThread)
 	if config.MaxConnsPerThread > 0 {
 		t.tickets = make(chan struct{}, config.MaxConnsPerThread)
 	}
@@ -46,25 +78,52 @@ func (t *thread) closed() bool {
 	return t.idleConns == nil
 }
 
-func (t *thread) acquireTicket(deadline time.Time) error {
-	if t.tickets == nil {
-		return nil
+func (t *thread) acquireTicket(ctx context.Context, deadline time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	select {
-	case t.tickets <- struct{}{}:
+	if t.tryAcquireTicket() {
+		t.observeTicketWait(0, nil)
 		return nil
-	default:
 	}
 
-	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	ctx, cancel := context.WithDeadline(ctx, deadline)
 	defer cancel()
 
+	start := time.Now()
+	var err error
 	select {
 	case t.tickets <- struct{}{}:
-		return nil
 	case <-ctx.Done():
-		return ctx.Err()
+		err = ctx.Err()
+	}
+
+	t.observeTicketWait(time.Since(start), err)
+	return err
+}
+
+// observeTicketWait reports a ticket acquired for a request, or failed.
+func (t *thread) observeTicketWait(wait time.Duration, err error) {
+	if err == nil {
+		t.ticketsAcquired.Add(1)
+		t.ticketWait.Add(int64(wait))
+	}
+	if t.observer != nil {
+		t.observer.OnTicketWait(t.route, t.id, wait, err)
+	}
+}
+
+func (t *thread) tryAcquireTicket() bool {
+	if t.tickets == nil {
+		return true
+	}
+
+	select {
+	case t.tickets <- struct{}{}:
+		return true
+	default:
+		return false
 	}
 }
 
@@ -74,59 +133,142 @@ func (t *thread) releaseTicket() {
 	}
 }
 
-func (t *thread) __dispatch() (*proto.CacheConn, error) {
+// expired reports whether c should be closed instead of being used.
+func (t *thread) expired(c idleConn, now time.Time) bool {
+	return (t.idleTimeout > 0 && now.Sub(c.since) > t.idleTimeout) ||
+		(t.maxLifetime > 0 && now.Sub(c.Dialed()) > t.maxLifetime)
+}
+
+// __dispatch returns the last idle connection that is not expired, and the
+// expired connections popped before it.
+func (t *thread) __dispatch(now time.Time) (*proto.CacheConn, []idleConn, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
 	if t.closed() {
-		return nil, errors.New("thread is close")
+		return nil, nil, errors.New("thread is close")
 	}
 
-	if len(t.idleConns) == 0 {
-		return nil, nil
+	for last := len(t.idleConns) - 1; last >= 0; last-- {
+		c := t.idleConns[last]
+		if !t.expired(c, now) {
+			expired := slices.Clone(t.idleConns[last+1:])
+			t.idleConns = t.idleConns[:last]
+			return c.CacheConn, expired, nil
+		}
 	}
 
-	last := len(t.idleConns) - 1
-	conn := t.idleConns[last]
-	t.idleConns = t.idleConns[:last]
-	return conn, nil
+	expired := slices.Clone(t.idleConns)
+	t.idleConns = t.idleConns[:0]
+	return nil, expired, nil
 }
 
 func (t *thread) dispatch(deadline time.Time) (*proto.CacheConn, error) {
-	conn, err := t.__dispatch()
-	if conn != nil && conn.SetDeadline(deadline) != nil {
-		conn.Close()
-		return nil, nil
+	conn, expired, err := t.__dispatch(time.Now())
+	for _, c := range expired {
+		t.closeConn(c.CacheConn, nil)
+	}
+	if conn != nil {
+		if err := conn.SetDeadline(deadline); err != nil {
+			t.closeConn(conn, err)
+			return nil, nil
+		}
 	}
 	return conn, err
 }
 
+// closeConn closes c that is useless because of err.
+func (t *thread) closeConn(c *proto.CacheConn, err error) {
+	c.Close()
+	if err != nil {
+		t.errorCloses.Add(1)
+	}
+	if t.observer != nil {
+		t.observer.OnConnClose(t.route, t.id, err)
+	}
+}
+
 func (t *thread) _return(c *proto.CacheConn) {
+	ic := idleConn{c, time.Now()}
+
+	t.mu.Lock()
+	closed := t.closed() || t.expired(ic, ic.since)
+	if !closed {
+		t.idleConns = append(t.idleConns, ic)
+	}
+	t.mu.Unlock()
+
+	if closed {
+		t.closeConn(c, nil)
+	}
+}
+
+// sweep closes expired idle connections.
+func (t *thread) sweep(now time.Time) {
+	t.mu.Lock()
+	var expired []idleConn
+	kept := t.idleConns[:0]
+	for _, c := range t.idleConns {
+		if t.expired(c, now) {
+			expired = append(expired, c)
+		} else {
+			kept = append(kept, c)
+		}
+	}
+	if t.idleConns != nil {
+		clear(t.idleConns[len(kept):])
+		t.idleConns = kept
+	}
+	t.mu.Unlock()
+
+	for _, c := range expired {
+		t.closeConn(c.CacheConn, nil)
+	}
+}
+
+func (t *thread) lacksIdle() bool {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	if t.closed() {
-		c.Close()
-	} else {
-		t.idleConns = append(t.idleConns, c)
+	return !t.closed() && len(t.idleConns) < t.minIdle
+}
+
+// fill dials until there are minIdle idle connections, connections in use
+// hold tickets, so that MaxConnsPerThread is respected. Dial failures are
+// logged by dial.
+func (t *thread) fill(ctx context.Context, deadline time.Time) {
+	for t.lacksIdle() && t.tryAcquireTicket() {
+		conn, err := t.dial(ctx, deadline)
+		if err == nil {
+			t._return(conn)
+		}
+		t.releaseTicket()
+		if err != nil {
+			return
+		}
 	}
 }
 
-func (t *thread) __getOrSet(conn *proto.CacheConn, key []byte, get proto.FallbackGetFunc) (val []byte, err error) {
+func (t *thread) __getOrSet(ctx context.Context, conn *proto.CacheConn, key []byte, get proto.FallbackGetFunc) (val []byte, err error) {
+	stop := conn.Watch(ctx)
 	val, err = conn.GetOrSet(key, get)
-	if err == nil {
+	if stop() && err == nil {
 		t._return(conn)
-	} else {
-		conn.Close()
-		if val != nil {
-			err = nil
-		}
+		return
+	}
+
+	t.closeConn(conn, errOr(err, ctx.Err()))
+	if err != nil && ctx.Err() != nil {
+		err = fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
+	if val != nil {
+		err = nil
 	}
 	return
 }
 
-func (t *thread) GetOrSet(deadline time.Time, key []byte, get proto.FallbackGetFunc) (val []byte, err error) {
-	err = t.acquireTicket(deadline)
+func (t *thread) GetOrSet(ctx context.Context, deadline time.Time, key []byte, get proto.FallbackGetFunc) (val []byte, err error) {
+	err = t.acquireTicket(ctx, deadline)
 	if err != nil {
 		return
 	}
@@ -138,32 +280,94 @@ func (t *thread) GetOrSet(deadline time.Time, key []byte, get proto.FallbackGetF
 	}
 
 	if conn != nil {
-		val, err = t.__getOrSet(conn, key, get)
-		if err == nil {
+		val, err = t.__getOrSet(ctx, conn, key, get)
+		if err == nil || ctx.Err() != nil {
 			return
 		}
 	}
 
-	conn, err = proto.DialCache(deadline, t.route, t.id, t.config)
+	conn, err = t.dial(ctx, deadline)
 	if err != nil {
-		return nil, fmt.Errorf("dial cache: %s %d failed: %w", t.route, t.id, err)
+		return nil, err
 	}
 
-	return t.__getOrSet(conn, key, get)
+	return t.__getOrSet(ctx, conn, key, get)
 }
 
-func (t *thread) __del(conn *proto.CacheConn, key []byte) error {
+// GetOrSetAppend is like GetOrSet, but appends the value to dst, dst is
+// returned on error.
+func (t *thread) GetOrSetAppend(ctx context.Context, deadline time.Time, dst, key []byte, get proto.FallbackGetFunc) ([]byte, error) {
+	err := t.acquireTicket(ctx, deadline)
+	if err != nil {
+		return dst, err
+	}
+	defer t.releaseTicket()
+
+	val, miss, err := t.lookup(ctx, deadline, dst, key)
+	if err != nil {
+		return dst, err
+	}
+	if miss == nil {
+		return val, nil
+	}
+
+	if get == nil {
+		err = fmt.Errorf("%w: nil", proto.ErrFallbackGet)
+	} else {
+		val, err = get(key)
+		if err != nil {
+			err = fmt.Errorf("%w: %w", proto.ErrFallbackGet, err)
+		}
+	}
+	if err != nil {
+		t.closeConn(miss, err)
+		return dst, err
+	}
+
+	t.populate(ctx, miss, val)
+	if dst == nil {
+		return val, nil
+	}
+	return append(dst, val...), nil
+}
+
+func (t *thread) dial(ctx context.Context, deadline time.Time) (*proto.CacheConn, error) {
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := proto.DialCacheContextWithDialer(ctx, t.route, t.id, t.dialer)
+	t.dials.Add(1)
+	if err != nil {
+		t.dialFailures.Add(1)
+	}
+	if t.observer != nil {
+		t.observer.OnDial(t.route, t.id, time.Since(start), err)
+	}
+	if err != nil {
+		t.logger.Warn("dial cache failed", logAddress, t.route, logThread, t.id, "error", err)
+		return nil, fmt.Errorf("dial cache: %s %d failed: %w", t.route, t.id, err)
+	}
+	return conn, nil
+}
+
+func (t *thread) __del(ctx context.Context, conn *proto.CacheConn, key []byte) error {
+	stop := conn.Watch(ctx)
 	err := conn.Del(key)
-	if err == nil {
+	if stop() && err == nil {
 		t._return(conn)
-	} else {
-		conn.Close()
+		return nil
+	}
+
+	t.closeConn(conn, errOr(err, ctx.Err()))
+	if err != nil && ctx.Err() != nil {
+		err = fmt.Errorf("%w: %w", ctx.Err(), err)
 	}
 	return err
 }
 
-func (t *thread) Del(deadline time.Time, key []byte) error {
-	err := t.acquireTicket(deadline)
+func (t *thread) Del(ctx context.Context, deadline time.Time, key []byte) error {
+	err := t.acquireTicket(ctx, deadline)
 	if err != nil {
 		return err
 	}
@@ -174,24 +378,96 @@ func (t *thread) Del(deadline time.Time, key []byte) error {
 		return fmt.Errorf("dispatch failed: %w", err)
 	}
 
-	if conn != nil && t.__del(conn, key) == nil {
-		return nil
+	if conn != nil {
+		err = t.__del(ctx, conn, key)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
 	}
 
-	conn, err = proto.DialCache(deadline, t.route, t.id, t.config)
+	conn, err = t.dial(ctx, deadline)
 	if err != nil {
-		return fmt.Errorf("dial cache: %s %d failed: %w", t.route, t.id, err)
+		return err
 	}
 
-	return t.__del(conn, key)
+	return t.__del(ctx, conn, key)
+}
+
+func (t *thread) __lookup(ctx context.Context, conn *proto.CacheConn, dst, key []byte) ([]byte, *proto.CacheConn, error) {
+	stop := conn.Watch(ctx)
+	val, hit, err := conn.GetAppend(dst, key)
+	if !stop() {
+		t.closeConn(conn, errOr(err, ctx.Err()))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ctx.Err(), err)
+		}
+		if !hit {
+			return nil, nil, ctx.Err()
+		}
+		return val, nil, nil
+	}
+
+	if err != nil {
+		t.closeConn(conn, err)
+		return nil, nil, err
+	}
+
+	if hit {
+		t._return(conn)
+		return val, nil, nil
+	}
+	return nil, conn, nil
+}
+
+// lookup appends the value to dst on a hit, and returns the connection
+// holding the populate lock on a miss, which should be passed to populate.
+// The caller should hold a ticket until then.
+func (t *thread) lookup(ctx context.Context, deadline time.Time, dst, key []byte) ([]byte, *proto.CacheConn, error) {
+	conn, err := t.dispatch(deadline)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dispatch failed: %w", err)
+	}
+
+	if conn != nil {
+		val, miss, err := t.__lookup(ctx, conn, dst, key)
+		if err == nil || ctx.Err() != nil || errors.Is(err, proto.ErrClientSide) {
+			return val, miss, err
+		}
+	}
+
+	conn, err = t.dial(ctx, deadline)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return t.__lookup(ctx, conn, dst, key)
+}
+
+func (t *thread) populate(ctx context.Context, conn *proto.CacheConn, val []byte) {
+	stop := conn.Watch(ctx)
+	err := conn.Set(val)
+	if stop() && err == nil {
+		t._return(conn)
+	} else {
+		t.closeConn(conn, errOr(err, ctx.Err()))
+	}
 }
 
 func (t *thread) Close() {
 	t.mu.Lock()
-	defer t.mu.Unlock()
+	conns := t.idleConns
+	t.idleConns = nil
+	t.mu.Unlock()
 
-	for _, conn := range t.idleConns {
-		conn.Close()
+	// the observer may call Stats, which takes t.mu
+	for _, conn := range conns {
+		t.closeConn(conn.CacheConn, nil)
 	}
-	t.idleConns = nil
+}
+
+func errOr(err error, or error) error {
+	if err != nil {
+		return err
+	}
+	return or
 }
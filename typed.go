@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DecodeError is returned if a cached value can not be decoded by the Codec,
+// it tells a corrupt or incompatible entry from a transport error.
+type DecodeError struct {
+	Key []byte
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode value of key: %q failed: %v", e.Key, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// TypedFallbackGetFunc is called on miss like proto.FallbackGetFunc.
+type TypedFallbackGetFunc[K, V any] func(ctx context.Context, key K) (V, error)
+
+type TypedConfig[K, V any] struct {
+	// Key encodes K to the cache key, see StringKey and BytesKey.
+	Key   func(key K) []byte
+	Codec Codec[V]
+	// DelCorrupt deletes the entry that fails to decode, so that the next
+	// GetOrSet calls the fallback instead of failing again.
+	DelCorrupt bool
+}
+
+// Typed is a Cache of values of type V, keyed by K.
+type Typed[K, V any] struct {
+	cache  Cache
+	config TypedConfig[K, V]
+}
+
+func NewTyped[K, V any](cache Cache, config TypedConfig[K, V]) (*Typed[K, V], error) {
+	if config.Key == nil {
+		return nil, errors.New("bad TypedConfig: nil Key")
+	}
+	if config.Codec == nil {
+		return nil, errors.New("bad TypedConfig: nil Codec")
+	}
+	return &Typed[K, V]{cache, config}, nil
+}
+
+func (t *Typed[K, V]) GetOrSet(ctx context.Context, key K, get TypedFallbackGetFunc[K, V]) (V, error) {
+	var zero V
+	k := t.config.Key(key)
+
+	var c fallbackCapture[V]
+	data, err := t.cache.GetOrSetContext(ctx, k, captureFallback(&c, key, get, func(_ context.Context, val V) ([]byte, error) {
+		data, err := t.config.Codec.Encode(val)
+		if err != nil {
+			return nil, fmt.Errorf("encode value of key: %q failed: %w", k, err)
+		}
+		return data, nil
+	}))
+	if err != nil {
+		return zero, err
+	}
+	if c.got {
+		return c.val, nil
+	}
+
+	val, err := t.config.Codec.Decode(data)
+	if err == nil {
+		return val, nil
+	}
+
+	err = &DecodeError{k, err}
+	if t.config.DelCorrupt {
+		delErr := t.cache.DelContext(ctx, k)
+		if delErr != nil {
+			return zero, fmt.Errorf("%w, del failed: %w", err, delErr)
+		}
+	}
+	return zero, err
+}
+
+func (t *Typed[K, V]) Del(ctx context.Context, key K) error {
+	return t.cache.DelContext(ctx, t.config.Key(key))
+}
+
+// Cache returns the underlying Cache.
+func (t *Typed[K, V]) Cache() Cache {
+	return t.cache
+}
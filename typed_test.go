@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+type typedUser struct {
+	Name string
+	Age  int
+}
+
+func TestTyped(t *testing.T) {
+	memory := NewMemory(KeySizeLimit, TIMEOUT)
+	defer memory.Close()
+
+	t.Run("JSON", testTypedCodec(memory, JSONCodec[typedUser]{}))
+	t.Run("Gob", testTypedCodec(memory, GobCodec[typedUser]{}))
+	t.Run("Corrupt", testTypedCorrupt(memory))
+	t.Run("NilFallback", testTypedNilFallback(memory))
+}
+
+func testTypedCodec(memory *Memory, codec Codec[typedUser]) func(t *testing.T) {
+	return func(t *testing.T) {
+		typed, err := NewTyped(memory, TypedConfig[string, typedUser]{
+			Key:   StringKey,
+			Codec: codec,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := context.Background()
+		want := typedUser{"alice", 30}
+		calls := 0
+		get := func(ctx context.Context, key string) (typedUser, error) {
+			calls++
+			return typedUser{key, 30}, nil
+		}
+		for range 2 {
+			got, err := typed.GetOrSet(ctx, "alice", get)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("want: %v, got: %v", want, got)
+			}
+		}
+		if calls != 1 {
+			t.Fatalf("fallback called %d times", calls)
+		}
+
+		err = typed.Del(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testTypedCorrupt(memory *Memory) func(t *testing.T) {
+	return func(t *testing.T) {
+		typed, err := NewTyped(memory, TypedConfig[string, typedUser]{
+			Key:        StringKey,
+			Codec:      JSONCodec[typedUser]{},
+			DelCorrupt: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tc := Case{[]byte("bob"), []byte("not json")}
+		set(t, memory, tc)
+
+		ctx := context.Background()
+		get := func(ctx context.Context, key string) (typedUser, error) {
+			return typedUser{key, 40}, nil
+		}
+		_, err = typed.GetOrSet(ctx, "bob", get)
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("want DecodeError, got error: %v", err)
+		}
+
+		got, err := typed.GetOrSet(ctx, "bob", get)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != (typedUser{"bob", 40}) {
+			t.Fatalf("corrupt entry is not deleted, got: %v", got)
+		}
+	}
+}
+
+func testTypedNilFallback(memory *Memory) func(t *testing.T) {
+	return func(t *testing.T) {
+		typed, err := NewTyped(memory, TypedConfig[string, typedUser]{
+			Key:   StringKey,
+			Codec: JSONCodec[typedUser]{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = typed.GetOrSet(context.Background(), "nil-fallback", nil)
+		if !errors.Is(err, proto.ErrFallbackGet) {
+			t.Fatalf("want error: %v, got: %v", proto.ErrFallbackGet, err)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package umemtest
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+// world guards the registry, every cluster and Server.cluster, machines of a
+// cluster find each other by their admin addresses in the registry.
+var (
+	world    sync.Mutex
+	registry = make(map[string]*Server)
+)
+
+// cluster is shared by its running machines, it applies every change at
+// once, so it is always stable.
+type cluster struct {
+	_type    proto.ClusterType
+	version  uint64
+	nextID   uint32
+	leader   int // -1 for lost
+	machines []proto.Machine
+}
+
+func register(s *Server) {
+	world.Lock()
+	defer world.Unlock()
+
+	registry[s.admin] = s
+}
+
+func unregister(s *Server) {
+	world.Lock()
+	defer world.Unlock()
+
+	delete(registry, s.admin)
+	if s.cluster != nil {
+		s.cluster.version++
+		s.cluster.refresh()
+		s.cluster = nil
+	}
+}
+
+func (cl *cluster) index(addr *net.TCPAddr) int {
+	for i := range cl.machines {
+		if cl.machines[i].Match(addr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// refresh updates availability of machines and elects a new leader if the
+// leader is lost.
+func (cl *cluster) refresh() {
+	for i := range cl.machines {
+		m := &cl.machines[i]
+		s := registry[m.Addr.String()]
+		if s != nil {
+			s.cluster = cl
+		}
+		if m.Available() != (s != nil) {
+			m.Stability++
+		}
+	}
+
+	if cl.leader >= 0 && cl.machines[cl.leader].Available() {
+		return
+	}
+
+	cl.leader = -1
+	for i := range cl.machines {
+		if cl.machines[i].Available() {
+			cl.leader = i
+			return
+		}
+	}
+}
+
+func (cl *cluster) isLeader(s *Server) bool {
+	return cl.leader >= 0 && cl.machines[cl.leader].Addr.String() == s.admin
+}
+
+func appendMachine(dest []byte, m proto.Machine) []byte {
+	dest = append(dest, m.Addr.IP.To16()...)
+	dest = binary.BigEndian.AppendUint16(dest, uint16(m.Addr.Port))
+	dest = append(dest, 0, 0)
+	dest = binary.LittleEndian.AppendUint32(dest, m.ID)
+	dest = binary.LittleEndian.AppendUint64(dest, m.Stability)
+	return binary.LittleEndian.AppendUint64(dest, m.Version)
+}
+
+func newMachine(bin []byte) proto.Machine {
+	addr := new(net.TCPAddr)
+	addr.IP = make([]byte, 16)
+	copy(addr.IP, bin)
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		addr.IP = ip4
+	}
+	addr.Port = int(binary.BigEndian.Uint16(bin[16:]))
+	return proto.Machine{
+		Addr:      addr,
+		ID:        binary.LittleEndian.Uint32(bin[20:]),
+		Stability: binary.LittleEndian.Uint64(bin[24:]),
+		Version:   binary.LittleEndian.Uint64(bin[32:]),
+	}
+}
+
+func (s *Server) handleLeader(c *conn) {
+	res := make([]byte, 16+2+2)
+
+	world.Lock()
+	cl := s.cluster
+	if cl == nil || cl.leader < 0 {
+		res[18] = 1
+	} else {
+		addr := cl.machines[cl.leader].Addr
+		copy(res, addr.IP.To16())
+		binary.BigEndian.PutUint16(res[16:], uint16(addr.Port))
+	}
+	world.Unlock()
+
+	c.write(res)
+}
+
+// SetClusterType sets the type of the cluster s is in, without changing the
+// version, so that tests can change the type alone.
+func (s *Server) SetClusterType(t proto.ClusterType) {
+	world.Lock()
+	defer world.Unlock()
+
+	if s.cluster != nil {
+		s.cluster._type = t
+	}
+}
+
+func (s *Server) handleCluster(c *conn) {
+	world.Lock()
+	cl := s.cluster
+	if cl == nil {
+		world.Unlock()
+		return
+	}
+
+	res := make([]byte, 1+7+8+8, 1+7+8+8+len(cl.machines)*_MACHINE_BIN_SIZE)
+	res[0] = byte(cl._type)
+	binary.LittleEndian.PutUint64(res[8:], uint64(len(cl.machines)*_MACHINE_BIN_SIZE))
+	binary.LittleEndian.PutUint64(res[16:], cl.version)
+	for _, m := range cl.machines {
+		res = appendMachine(res, m)
+	}
+	world.Unlock()
+
+	c.write(res)
+}
+
+func (s *Server) approve(count byte) ([]byte, bool) {
+	world.Lock()
+	defer world.Unlock()
+
+	cl := s.cluster
+	if cl == nil || !cl.isLeader(s) {
+		return nil, false
+	}
+
+	approval := make([]byte, 8+8)
+	binary.LittleEndian.PutUint64(approval, cl.version)
+	binary.LittleEndian.PutUint64(approval[8:], uint64(count))
+	return approval, true
+}
+
+func (s *Server) handleAuthority(c *conn) {
+	res, ok := s.approve(0)
+	if !ok || c.write(res) != nil {
+		return
+	}
+
+	for {
+		count, err := c.reader.ReadByte()
+		if err != nil {
+			return
+		}
+
+		approval, ok := s.approve(count)
+		if !ok || c.write(approval) != nil {
+			return
+		}
+	}
+}
+
+func recvMachines(c *conn) ([]proto.Machine, bool) {
+	req := make([]byte, 7+8)
+	if c.read(req) != nil {
+		return nil, false
+	}
+
+	size := binary.LittleEndian.Uint64(req[7:])
+	if size%_MACHINE_BIN_SIZE != 0 {
+		return nil, false
+	}
+
+	bin := make([]byte, size)
+	if c.read(bin) != nil {
+		return nil, false
+	}
+
+	machines := make([]proto.Machine, size/_MACHINE_BIN_SIZE)
+	for i := range machines {
+		machines[i] = newMachine(bin[i*_MACHINE_BIN_SIZE:])
+	}
+	return machines, true
+}
+
+func validMachines(machines []proto.Machine) bool {
+	n := len(machines)
+	if n < 4 || n&(n-1) != 0 {
+		return false
+	}
+
+	for i := range machines {
+		for j := range i {
+			if machines[i].Match(machines[j].Addr) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func sameMachines(cl *cluster, machines []proto.Machine) bool {
+	if len(cl.machines) != len(machines) {
+		return false
+	}
+	for i := range machines {
+		if !cl.machines[i].Match(machines[i].Addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) initCluster(machines []proto.Machine) bool {
+	world.Lock()
+	defer world.Unlock()
+
+	if s.cluster != nil {
+		return sameMachines(s.cluster, machines)
+	}
+
+	cl := &cluster{version: 1, leader: -1}
+	for _, m := range machines {
+		cl.machines = append(cl.machines, proto.Machine{Addr: m.Addr, ID: cl.nextID, Version: cl.version})
+		cl.nextID++
+	}
+
+	cl.leader = cl.index(s.listeners[1].Addr().(*net.TCPAddr))
+	if cl.leader < 0 {
+		return false
+	}
+	cl.refresh()
+	return true
+}
+
+// handleInitCluster accepts a duplicate initialization with the same
+// machines, so examples can share a cluster.
+func (s *Server) handleInitCluster(c *conn) {
+	machines, ok := recvMachines(c)
+	if !ok || !validMachines(machines) || !s.initCluster(machines) {
+		return
+	}
+	c.write([]byte{0})
+}
+
+func (s *Server) changeCluster(machines []proto.Machine) bool {
+	world.Lock()
+	defer world.Unlock()
+
+	cl := s.cluster
+	if cl == nil || !cl.isLeader(s) {
+		return false
+	}
+
+	// like umem-cache, a bad change is ignored silently
+	if !validMachines(machines) {
+		return true
+	}
+
+	leader := cl.machines[cl.leader].Addr
+	cl.version++
+	next := make([]proto.Machine, len(machines))
+	for i, m := range machines {
+		j := cl.index(m.Addr)
+		if j >= 0 {
+			next[i] = cl.machines[j]
+		} else {
+			next[i] = proto.Machine{Addr: m.Addr, ID: cl.nextID, Version: cl.version}
+			cl.nextID++
+		}
+	}
+
+	for _, m := range cl.machines {
+		removed := registry[m.Addr.String()]
+		if removed != nil {
+			removed.cluster = nil
+		}
+	}
+
+	cl.machines = next
+	cl.leader = cl.index(leader)
+	cl.refresh()
+	return true
+}
+
+func (s *Server) handleChangeCluster(c *conn) {
+	machines, ok := recvMachines(c)
+	if !ok || !s.changeCluster(machines) {
+		return
+	}
+	c.write([]byte{0})
+}
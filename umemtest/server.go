@@ -0,0 +1,364 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+// Package umemtest provides an in-process umem-cache server speaking the real
+// wire protocol, so the client can be tested without the umem-cache binary.
+package umemtest
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/imchuncai/umem-cache-client-Go/internal/populate"
+)
+
+type raftCommand byte
+
+const (
+	_CMD_REQUEST_VOTE raftCommand = iota
+	_CMD_APPEND_LOG
+	_CMD_HEARTBEAT
+	_CMD_INIT_CLUSTER
+	_CMD_CHANGE_CLUSTER
+	_CMD_ADMIN_DIVIDER
+	_CMD_LEADER
+	_CMD_CLUSTER
+	_CMD_CONNECT
+	_CMD_AUTHORITY
+)
+
+type _CMD byte
+
+const (
+	_CMD_GET_OR_SET _CMD = iota
+	_CMD_DEL
+)
+
+const _MACHINE_BIN_SIZE = 16 + 2 + 2 + 4 + 8 + 8
+
+type Config struct {
+	// AdminAddress also accepts cluster administration commands, it is the
+	// address of the machine in a cluster, empty for no cluster support.
+	AdminAddress      string
+	ThreadNR          int
+	MaxConnsPerThread int // 0 for no limit
+	// Timeout limits how long a missed key waits for its value, 0 for no limit.
+	Timeout   time.Duration
+	TLSConfig *tls.Config
+}
+
+type Server struct {
+	config Config
+	store  *populate.Store
+	// ctx is canceled once the server is closing
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu          sync.Mutex
+	closed      bool
+	listeners   []net.Listener
+	conns       map[net.Conn]struct{}
+	threadConns []int
+
+	admin   string
+	cluster *cluster // guarded by world
+}
+
+func NewServer(address string, config Config) (*Server, error) {
+	if config.ThreadNR <= 0 {
+		return nil, fmt.Errorf("bad ThreadNR: %d", config.ThreadNR)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		config:      config,
+		store:       populate.NewStore(),
+		ctx:         ctx,
+		cancel:      cancel,
+		conns:       make(map[net.Conn]struct{}),
+		threadConns: make([]int, config.ThreadNR),
+	}
+
+	err := s.listen(address, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.AdminAddress != "" {
+		err = s.listen(config.AdminAddress, true)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.admin = s.listeners[1].Addr().String()
+		register(s)
+	}
+	return s, nil
+}
+
+func (s *Server) listen(address string, admin bool) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("listen: %s failed: %w", address, err)
+	}
+	if s.config.TLSConfig != nil {
+		l = tls.NewListener(l, s.config.TLSConfig)
+	}
+
+	s.listeners = append(s.listeners, l)
+	s.wg.Add(1)
+	go s.serve(l, admin)
+	return nil
+}
+
+func (s *Server) Addr() string {
+	return s.listeners[0].Addr().String()
+}
+
+// AdminAddr returns the address of the machine in a cluster.
+func (s *Server) AdminAddr() string {
+	return s.admin
+}
+
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	if s.admin != "" {
+		unregister(s)
+	}
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) track(c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(c net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, c)
+	s.wg.Done()
+}
+
+func (s *Server) serve(l net.Listener, admin bool) {
+	defer s.wg.Done()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		if !s.track(c) {
+			c.Close()
+			return
+		}
+
+		go func() {
+			defer s.untrack(c)
+			defer c.Close()
+
+			s.handle(&conn{Conn: c, reader: bufio.NewReader(c), writer: bufio.NewWriter(c)}, admin)
+		}()
+	}
+}
+
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+	// key and res are reused, so that a hit makes no allocation in the
+	// server, and allocations of the client are measurable.
+	key [math.MaxUint8]byte
+	res [8 + 1]byte
+}
+
+func (c *conn) read(buff []byte) error {
+	_, err := io.ReadFull(c.reader, buff)
+	return err
+}
+
+func (c *conn) write(buffers ...[]byte) error {
+	for _, b := range buffers {
+		_, err := c.writer.Write(b)
+		if err != nil {
+			return err
+		}
+	}
+	return c.writer.Flush()
+}
+
+func (s *Server) handle(c *conn, admin bool) {
+	cmd, err := c.reader.ReadByte()
+	if err != nil {
+		return
+	}
+
+	switch raftCommand(cmd) {
+	case _CMD_CONNECT:
+		s.serveCache(c)
+	case _CMD_LEADER:
+		s.handleLeader(c)
+	case _CMD_CLUSTER:
+		s.handleCluster(c)
+	case _CMD_AUTHORITY:
+		s.handleAuthority(c)
+	case _CMD_INIT_CLUSTER:
+		if admin {
+			s.handleInitCluster(c)
+		}
+	case _CMD_CHANGE_CLUSTER:
+		if admin {
+			s.handleChangeCluster(c)
+		}
+	}
+}
+
+func (s *Server) connectThread(threadID uint32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if threadID >= uint32(s.config.ThreadNR) {
+		return false
+	}
+	if s.config.MaxConnsPerThread > 0 && s.threadConns[threadID] >= s.config.MaxConnsPerThread {
+		return false
+	}
+	s.threadConns[threadID]++
+	return true
+}
+
+func (s *Server) disconnectThread(threadID uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.threadConns[threadID]--
+}
+
+func (s *Server) serveCache(c *conn) {
+	req := make([]byte, 3+4)
+	if c.read(req) != nil {
+		return
+	}
+
+	threadID := binary.LittleEndian.Uint32(req[3:])
+	if !s.connectThread(threadID) {
+		return
+	}
+	defer s.disconnectThread(threadID)
+
+	if c.write([]byte{0}) != nil {
+		return
+	}
+
+	var head [2]byte
+	for {
+		if c.read(head[:]) != nil {
+			return
+		}
+
+		key := c.key[:head[1]]
+		if c.read(key) != nil {
+			return
+		}
+
+		var err error
+		switch _CMD(head[0]) {
+		case _CMD_GET_OR_SET:
+			err = s.getOrSet(c, key)
+		case _CMD_DEL:
+			s.store.Del(key)
+			err = c.write([]byte{0})
+		default:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) getOrSet(c *conn, key []byte) error {
+	e, miss, err := s.store.Acquire(s.ctx, key)
+	if err != nil {
+		return err
+	}
+
+	res := c.res[:]
+	if !miss {
+		binary.LittleEndian.PutUint64(res, uint64(len(e.Val)))
+		res[8] = 0
+		return c.write(res, e.Val)
+	}
+
+	clear(res)
+	res[8] = 1
+	val, err := s.recvValue(c, res)
+	if err != nil {
+		s.store.Abandon(key, e)
+		return err
+	}
+
+	s.store.Populate(key, e, val)
+	return nil
+}
+
+func (s *Server) recvValue(c *conn, res []byte) ([]byte, error) {
+	err := c.write(res)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.config.Timeout > 0 {
+		err = c.SetReadDeadline(time.Now().Add(s.config.Timeout))
+		if err != nil {
+			return nil, err
+		}
+		defer c.SetReadDeadline(time.Time{})
+	}
+
+	size := make([]byte, 8)
+	err = c.read(size)
+	if err != nil {
+		return nil, err
+	}
+
+	val := make([]byte, binary.LittleEndian.Uint64(size))
+	err = c.read(val)
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright (C) 2026, Shu De Zheng <imchuncai@gmail.com>. All Rights Reserved.
+
+package client
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/imchuncai/umem-cache-client-Go/proto"
+)
+
+// TopologyEvent is a change of the cluster observed by Cluster, the type,
+// the version, the leader or the machines including their availability.
+// The clusters should not be modified.
+type TopologyEvent struct {
+	Old       proto.Cluster
+	New       proto.Cluster
+	OldLeader string
+	NewLeader string
+}
+
+func (e *TopologyEvent) changed() bool {
+	return e.Old.Type != e.New.Type || e.Old.Version != e.New.Version ||
+		e.OldLeader != e.NewLeader || !machinesEqual(e.Old.Machines, e.New.Machines)
+}
+
+func machinesEqual(a, b []proto.Machine) bool {
+	return slices.EqualFunc(a, b, func(a, b proto.Machine) bool {
+		return a.ID == b.ID && a.Stability == b.Stability &&
+			a.Version == b.Version && proto.AddrEqual(a.Addr, b.Addr)
+	})
+}
+
+type watchers struct {
+	mu      sync.Mutex
+	next    uint64
+	fs      map[uint64]func(e TopologyEvent)
+	queue   []TopologyEvent
+	sending bool
+}
+
+// notify queues e without waiting for the watchers, the events are sent in
+// the order they are queued.
+func (w *watchers) notify(e TopologyEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.fs) == 0 {
+		return
+	}
+
+	w.queue = append(w.queue, e)
+	if !w.sending {
+		w.sending = true
+		go w.send()
+	}
+}
+
+// send calls the watchers in the order they are added with the queued events
+// until none is left, it is not called concurrently.
+func (w *watchers) send() {
+	for {
+		w.mu.Lock()
+		if len(w.queue) == 0 {
+			w.queue = nil
+			w.sending = false
+			w.mu.Unlock()
+			return
+		}
+		e := w.queue[0]
+		w.queue = w.queue[1:]
+
+		ids := make([]uint64, 0, len(w.fs))
+		for id := range w.fs {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		fs := make([]func(e TopologyEvent), len(ids))
+		for i, id := range ids {
+			fs[i] = w.fs[id]
+		}
+		w.mu.Unlock()
+
+		for _, f := range fs {
+			f(e)
+		}
+	}
+}
+
+// Watch calls f with every change of the cluster observed, in order, until
+// stop is called. f is called by a goroutine after the cluster is updated, a
+// slow f delays the later events, but not the operations. f may be called
+// once more by a notification in progress after stop returns.
+func (c *Cluster) Watch(f func(e TopologyEvent)) (stop func()) {
+	w := &c.watchers
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.fs == nil {
+		w.fs = make(map[uint64]func(e TopologyEvent))
+	}
+	id := w.next
+	w.next++
+	w.fs[id] = f
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		delete(w.fs, id)
+	}
+}